@@ -117,7 +117,7 @@ func actionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Updat
 				ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
 				MessageID:   update.CallbackQuery.Message.Message.ID,
 				Text:        "Control panel",
-				ReplyMarkup: getChatListKeyboard(chats),
+				ReplyMarkup: getChatListKeyboard(chats, update.CallbackQuery.From.ID == superAdminID),
 			})
 			if err != nil {
 				zap.S().Infof("[actionCallbackHandler] ACTION_SHOW_CHAT_LIST: EditMessageText failed: %v", err)
@@ -285,9 +285,11 @@ func actionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Updat
 				return
 			}
 			page := int(getInt(pageRaw))
-			zap.S().Infof("[actionCallbackHandler] ACTION_LIKES_PAGE: chatID=%d page=%d by userID=%d", data.ChatID, page, update.CallbackQuery.From.ID)
+			window := uint8(getInt(data.Data[DATA_TYPE_WINDOW]))
+			view := uint8(getInt(data.Data[DATA_TYPE_VIEW]))
+			zap.S().Infof("[actionCallbackHandler] ACTION_LIKES_PAGE: chatID=%d window=%d view=%d page=%d by userID=%d", data.ChatID, window, view, page, update.CallbackQuery.From.ID)
 
-			text, kb := renderLikesPage(ctx, data.ChatID, page)
+			text, kb := renderLikesPage(ctx, data.ChatID, window, view, page)
 			_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
 				ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
 				MessageID:   update.CallbackQuery.Message.Message.ID,
@@ -324,10 +326,157 @@ func actionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Updat
 				ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
 				MessageID:   update.CallbackQuery.Message.Message.ID,
 				Text:        "Control panel",
-				ReplyMarkup: getChatListKeyboard(chats),
+				ReplyMarkup: getChatListKeyboard(chats, update.CallbackQuery.From.ID == superAdminID),
 			})
 
 		}
+	case ACTION_PATTERN_LISTS:
+		{
+			if update.CallbackQuery.From.ID != superAdminID {
+				return
+			}
+			text, kb := renderPatternListsPage()
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_SHOW_PATTERN_LIST:
+		{
+			if update.CallbackQuery.From.ID != superAdminID {
+				return
+			}
+			text, kb := renderPatternListPage(getInt(data.Data[DATA_TYPE_LIST]))
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_DEL_LIST_PATTERN:
+		{
+			if update.CallbackQuery.From.ID != superAdminID {
+				return
+			}
+			listID := getInt(data.Data[DATA_TYPE_LIST])
+			index := int(getInt(data.Data[DATA_TYPE_INDEX]))
+			if removed, ok := removeListPattern(ctx, listID, index); ok {
+				zap.S().Infof("[actionCallbackHandler] ACTION_DEL_LIST_PATTERN: listID=%d pattern=%q removed", listID, removed)
+			}
+			text, kb := renderPatternListPage(listID)
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_DELETE_PATTERN_LIST:
+		{
+			if update.CallbackQuery.From.ID != superAdminID {
+				return
+			}
+			listID := getInt(data.Data[DATA_TYPE_LIST])
+			zap.S().Infof("[actionCallbackHandler] ACTION_DELETE_PATTERN_LIST: listID=%d", listID)
+			removePatternList(ctx, listID)
+			text, kb := renderPatternListsPage()
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_CHAT_PATTERN_LISTS:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			text, kb := renderChatPatternListsPage(data.ChatID)
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_TOGGLE_PATTERN_LIST:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			listID := getInt(data.Data[DATA_TYPE_LIST])
+			subscribed := togglePatternListSubscription(ctx, data.ChatID, listID)
+			zap.S().Infof("[actionCallbackHandler] ACTION_TOGGLE_PATTERN_LIST: chatID=%d listID=%d subscribed=%v by userID=%d",
+				data.ChatID, listID, subscribed, update.CallbackQuery.From.ID)
+			text, kb := renderChatPatternListsPage(data.ChatID)
+			editPanelMessage(ctx, b, update, text, kb)
+		}
+	case ACTION_PATTERN_STATS:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			editPanelMessage(ctx, b, update, renderPatternStats(ctx, data.ChatID), getBackToChatKeyboard(data.ChatID))
+		}
+	case ACTION_DELETE_MESSAGE:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			messageID := getInt(data.Data[DATA_TYPE_MSGID])
+			zap.S().Infof("[actionCallbackHandler] ACTION_DELETE_MESSAGE: chatID=%d messageID=%d by userID=%d", data.ChatID, messageID, update.CallbackQuery.From.ID)
+			text := "Сообщение удалено"
+			if _, err := b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: data.ChatID, MessageID: int(messageID)}); err != nil {
+				zap.S().Infof("[actionCallbackHandler] ACTION_DELETE_MESSAGE: DeleteMessage failed for chatID=%d messageID=%d: %v", data.ChatID, messageID, err)
+				text = "Не удалось удалить сообщение"
+			}
+			systemAnswerToMessage(ctx, b, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.ID, text, false, 30)
+		}
+	case ACTION_BAN_USER:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			userID := getInt(data.Data[DATA_TYPE_USERID])
+			messageID := getInt(data.Data[DATA_TYPE_MSGID])
+			zap.S().Infof("[actionCallbackHandler] ACTION_BAN_USER: chatID=%d userID=%d by userID=%d", data.ChatID, userID, update.CallbackQuery.From.ID)
+			text := "Пользователь заблокирован"
+			if !banFromReport(ctx, b, data.ChatID, userID, messageID, update.CallbackQuery.From.ID) {
+				text = "Не удалось заблокировать пользователя"
+			}
+			systemAnswerToMessage(ctx, b, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.ID, text, false, 30)
+		}
+	case ACTION_START_VOTE:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			userID := getInt(data.Data[DATA_TYPE_USERID])
+			// Buttons from before the rule was carried have no index.
+			ruleIdx := int64(-1)
+			if raw, ok := data.Data[DATA_TYPE_RULE]; ok {
+				ruleIdx = getInt(raw)
+			}
+			zap.S().Infof("[actionCallbackHandler] ACTION_START_VOTE: chatID=%d userID=%d rule=%d by userID=%d", data.ChatID, userID, ruleIdx, update.CallbackQuery.From.ID)
+			reason := "Голосование по отчёту детектора"
+			if ruleIdx >= 0 && ruleIdx < int64(len(detectorRules)) {
+				rule := detectorRules[ruleIdx]
+				reason = fmt.Sprintf("Голосование по отчёту детектора, правило %s: %s", rule.Name(), rule.Description())
+			}
+			text := "Голосование начато"
+			if _, ok := startDetectorVote(ctx, b, BAN, data.ChatID, userID, 0, reason, "", update.CallbackQuery.From.ID); !ok {
+				text = "Голосование уже идёт, пользователь недавно заблокирован или его не удалось начать"
+			}
+			systemAnswerToMessage(ctx, b, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.ID, text, false, 30)
+		}
+	case ACTION_CAPTCHA:
+		{
+			captchaCallback(ctx, b, update, data)
+		}
+	case ACTION_END_RAID, ACTION_BAN_RAID:
+		{
+			if !isUserAdmin(ctx, b, data.ChatID, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.Chat.ID, update.CallbackQuery.Message.Message.ID) {
+				return
+			}
+			outcome := RAID_LIFTED
+			if data.Action == ACTION_BAN_RAID {
+				outcome = RAID_BANNED
+			}
+			raidCallback(ctx, b, update, data, outcome)
+		}
+	}
+}
+
+// editPanelMessage replaces the control panel message the callback came from
+// with a new page.
+func editPanelMessage(ctx context.Context, b *bot.Bot, update *models.Update, text string, kb *models.InlineKeyboardMarkup) {
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      update.CallbackQuery.Message.Message.Chat.ID,
+		MessageID:   update.CallbackQuery.Message.Message.ID,
+		Text:        text,
+		ReplyMarkup: kb,
+	})
+	if err != nil {
+		zap.S().Infof("[editPanelMessage] EditMessageText failed: %v", err)
 	}
 }
 
@@ -415,7 +564,7 @@ func startHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 			ChatID:      chatID,
 			Text:        "Control panel",
 			ParseMode:   models.ParseModeMarkdown,
-			ReplyMarkup: getChatListKeyboard(chats),
+			ReplyMarkup: getChatListKeyboard(chats, userID == superAdminID),
 		})
 		if err != nil {
 			zap.S().Info(err)
@@ -13,6 +13,7 @@ const (
 	BAN uint8 = iota
 	MUTE
 	TEXT_ONLY
+	JOIN_REQUEST
 )
 
 // voteType collects everything that varies between the kinds of vote: the vote
@@ -26,9 +27,24 @@ type voteType struct {
 	upAnswer   string // shown to a voter whose upvote was accepted
 	downAnswer string // shown to a voter whose downvote was accepted
 
+	// message renders the vote message text.
+	message func(b *BanInfo) string
+
 	// apply carries out the moderation action once the vote has passed, and
 	// reports whether it succeeded.
 	apply func(ctx context.Context, b *bot.Bot, s *BanInfo) bool
+
+	// cancel, when set, acts on a vote that was voted down, for kinds of vote
+	// that cannot simply be dropped.
+	cancel func(ctx context.Context, b *bot.Bot, s *BanInfo)
+
+	// expire, when set, acts on a vote that expired undecided, including the
+	// votes dropped on shutdown.
+	expire func(ctx context.Context, b *bot.Bot, s *BanInfo)
+
+	// noFrag marks votes that punish nobody, so passing them earns the owner
+	// no frag.
+	noFrag bool
 }
 
 var voteTypes = map[uint8]voteType{
@@ -37,6 +53,7 @@ var voteTypes = map[uint8]voteType{
 		downText:   "Против бана",
 		upAnswer:   "Голос за бан принят",
 		downAnswer: "Голос против бана принят",
+		message:    makeBanMessage,
 		apply:      banUser,
 	},
 	MUTE: {
@@ -44,6 +61,7 @@ var voteTypes = map[uint8]voteType{
 		downText:   "Против мута",
 		upAnswer:   "Голос за мут принят",
 		downAnswer: "Голос против мута принят",
+		message:    makeMuteMessage,
 		apply:      muteUser,
 	},
 	TEXT_ONLY: {
@@ -51,8 +69,20 @@ var voteTypes = map[uint8]voteType{
 		downText:   "Обычный режим",
 		upAnswer:   "Голос за режим «только текст» принят",
 		downAnswer: "Голос за обычный режим принят",
+		message:    makeTextOnlyMessage,
 		apply:      textOnlyUser,
 	},
+	JOIN_REQUEST: {
+		upText:     "Принять",
+		downText:   "Отклонить",
+		upAnswer:   "Голос за то, чтобы принять заявку, учтён",
+		downAnswer: "Голос за то, чтобы отклонить заявку, учтён",
+		message:    makeJoinRequestMessage,
+		apply:      approveJoinRequest,
+		cancel:     declineJoinRequest,
+		expire:     expireJoinRequest,
+		noFrag:     true,
+	},
 }
 
 type BanInfo struct {
@@ -70,7 +100,13 @@ type BanInfo struct {
 	Voters           map[int64]int8
 	Type             uint8
 	CreatedAt        time.Time
-	cancelPin        context.CancelFunc
+	// Pattern is the ban pattern that started an automatic vote; empty for
+	// votes started by people.
+	Pattern   string
+	cancelPin context.CancelFunc
+	// applicantHistory is what the bot knows about a join request's applicant,
+	// shown in the vote message.
+	applicantHistory string
 }
 
 const (
@@ -84,10 +120,12 @@ func makeBanMessage(b *BanInfo) string {
 	return makeVoteText(b, "блокировку")
 }
 
-func calculateRequiredRating(userScore uint32) (requiredScore int16) {
-	if userScore < 10 {
+// calculateRequiredRating is the vote margin needed against a user with the
+// given recent rating (see recentRating).
+func calculateRequiredRating(rating int) (requiredScore int16) {
+	if rating < 10 {
 		requiredScore = LOW_SCORE
-	} else if userScore < 100 {
+	} else if rating < 100 {
 		requiredScore = MID_SCORE
 	} else {
 		requiredScore = HIGH_SCORE
@@ -123,7 +161,6 @@ func banUser(ctx context.Context, b *bot.Bot, s *BanInfo) bool {
 	var banUsertag string
 
 	cacheBanInfo(s.ChatID, s.UserID)
-	reactionCache.Delete(reactionKey{chatID: s.ChatID, userID: s.UserID})
 
 	if len(s.UserName) != 0 {
 		banUsertag = fmt.Sprintf("@%s", escape(s.UserName))
@@ -172,7 +209,9 @@ func banUser(ctx context.Context, b *bot.Bot, s *BanInfo) bool {
 		getBanMessageKeyboard(s.ChatID, s.UserID, s.VoteMessageID), "banUser")
 
 	if result {
-		reactionCache.Delete(reactionKey{chatID: s.ChatID, userID: s.UserID})
+		// Drop the banned user's reactions from /likes and the karma they gave.
+		deleteUserReactions(ctx, s.ChatID, s.UserID)
+		revokeReactionKarma(ctx, s.ChatID, s.UserID)
 	}
 	return result
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// captchaTimeout is the default number of seconds a newcomer has to solve
+	// the captcha before being kicked.
+	captchaTimeout = 120
+	// captchaMinTimeout and captchaMaxTimeout bound /captcha on <секунды>.
+	captchaMinTimeout = 30
+	captchaMaxTimeout = 3600
+	// captchaOptions is the number of buttons in a challenge.
+	captchaOptions = 4
+)
+
+// captchaItems are what a challenge asks to pick, by the emoji on the button
+// and the word in the challenge text: a bot has to understand the word to find
+// the button.
+var captchaItems = []struct {
+	emoji string
+	name  string
+}{
+	{"🍎", "яблоко"},
+	{"🚗", "машина"},
+	{"🐱", "кошка"},
+	{"⚽", "мяч"},
+	{"🌲", "ёлка"},
+	{"🎸", "гитара"},
+	{"🏠", "дом"},
+	{"✈️", "самолёт"},
+	{"🐟", "рыба"},
+	{"☂️", "зонт"},
+}
+
+// newCaptcha picks n distinct captchaItems indexes for the buttons and which of
+// them is the answer.
+func newCaptcha(r *rand.Rand, n int) (options []int, answer int) {
+	options = r.Perm(len(captchaItems))[:n]
+	return options, options[r.IntN(n)]
+}
+
+// isChatMemberPresent reports whether a chat member status means the user is in
+// the chat.
+func isChatMemberPresent(m models.ChatMember) bool {
+	switch m.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true
+	case models.ChatMemberTypeRestricted:
+		return m.Restricted != nil && m.Restricted.IsMember
+	}
+	return false
+}
+
+// joinedMember returns the user a chat member update is about when it is a
+// join as a regular member, nil otherwise. Joins of restricted users are left
+// alone: lifting a captcha would lift their restrictions too.
+func joinedMember(upd *models.ChatMemberUpdated) *models.User {
+	if isChatMemberPresent(upd.OldChatMember) || upd.NewChatMember.Type != models.ChatMemberTypeMember || upd.NewChatMember.Member == nil {
+		return nil
+	}
+	return upd.NewChatMember.Member.User
+}
+
+// chatCaptcha returns whether the chat has the captcha on and its timeout in
+// seconds, without creating a settings record.
+func chatCaptcha(chatID int64) (enabled bool, timeout int) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		enabled, timeout = chatSettings.Captcha, chatSettings.CaptchaTimeout
+	}
+	if timeout == 0 {
+		timeout = captchaTimeout
+	}
+	return enabled, timeout
+}
+
+// processChatMember handles chat_member updates: it counts joins for raid
+// detection, screens the names of users joining a chat, challenges them when
+// the chat has the captcha on or puts them on probation, and drops the
+// challenge of users who left.
+func processChatMember(ctx context.Context, b *bot.Bot, upd *models.ChatMemberUpdated) {
+	chatID := upd.Chat.ID
+	if !isChatMemberPresent(upd.NewChatMember) {
+		if user := chatMemberUser(upd.NewChatMember); user != nil {
+			if challenge, err := getCaptcha(ctx, chatID, user.ID); err == nil {
+				closeCaptcha(ctx, b, challenge)
+			}
+		}
+		return
+	}
+	user := joinedMember(upd)
+	if user == nil || user.IsBot {
+		return
+	}
+	if processRaidJoin(ctx, b, chatID, user) {
+		// Raid joiners are restricted already; admins decide on them at once.
+		return
+	}
+	if screenJoinName(ctx, b, chatID, user) {
+		// Solving the captcha would lift the name check's restriction.
+		return
+	}
+	enabled, timeout := chatCaptcha(chatID)
+	probation, _, _ := chatProbation(chatID)
+	if !enabled && !probation {
+		return
+	}
+	if upd.From.ID != user.ID {
+		// Added by someone else: an admin vouches for whoever they add.
+		adminsMux.Lock()
+		_, isAdmin := checkAdmins(ctx, b, chatID)[upd.From.ID]
+		adminsMux.Unlock()
+		if isAdmin {
+			return
+		}
+	}
+	if !enabled {
+		startProbation(ctx, b, chatID, user.ID)
+		return
+	}
+	startCaptcha(ctx, b, chatID, user, timeout)
+}
+
+// chatMemberUser returns the user a chat member status is about.
+func chatMemberUser(m models.ChatMember) *models.User {
+	switch {
+	case m.Left != nil:
+		return m.Left.User
+	case m.Banned != nil:
+		return m.Banned.User
+	case m.Restricted != nil:
+		return m.Restricted.User
+	case m.Member != nil:
+		return m.Member.User
+	}
+	return nil
+}
+
+// restrictNewcomer takes every permission from a newcomer until it is lifted.
+func restrictNewcomer(ctx context.Context, b *bot.Bot, chatID, userID int64) bool {
+	if _, err := b.RestrictChatMember(ctx, &bot.RestrictChatMemberParams{
+		ChatID:      chatID,
+		UserID:      userID,
+		Permissions: &models.ChatPermissions{},
+	}); err != nil {
+		zap.S().Infof("[restrictNewcomer] RestrictChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+		return false
+	}
+	return true
+}
+
+// startCaptcha restricts a newcomer and posts the challenge.
+func startCaptcha(ctx context.Context, b *bot.Bot, chatID int64, user *models.User, timeout int) {
+	if !restrictNewcomer(ctx, b, chatID, user.ID) {
+		return
+	}
+
+	options, answer := newCaptcha(rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), captchaOptions)
+	row := make([]models.InlineKeyboardButton, 0, len(options))
+	for _, option := range options {
+		button, ok := actionButton(captchaItems[option].emoji, &Item{
+			Action: ACTION_CAPTCHA,
+			ChatID: chatID,
+			Data:   map[uint8]interface{}{DATA_TYPE_USERID: user.ID, DATA_TYPE_INDEX: option},
+		})
+		if !ok {
+			return
+		}
+		row = append(row, button)
+	}
+	text := fmt.Sprintf("%s, чтобы писать в чате, нажмите на кнопку «%s» в течение %d секунд\\.",
+		userTag(user.Username, user.FirstName+" "+user.LastName, user.ID), escape(captchaItems[answer].name), timeout)
+	sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeMarkdown,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}},
+	})
+	if err != nil {
+		zap.S().Infof("[startCaptcha] SendMessage failed for chatID=%d userID=%d: %v", chatID, user.ID, err)
+		return
+	}
+	saveCaptcha(ctx, &CaptchaChallenge{
+		ChatID:    chatID,
+		UserID:    user.ID,
+		MessageID: sent.ID,
+		Answer:    answer,
+		Deadline:  time.Now().Add(time.Duration(timeout) * time.Second),
+	})
+	zap.S().Infof("[startCaptcha] chatID=%d userID=%d challenged, timeout=%ds", chatID, user.ID, timeout)
+}
+
+// captchaCallback checks a newcomer's answer: the right button releases them,
+// a wrong one kicks. Presses by anyone else are ignored.
+func captchaCallback(ctx context.Context, b *bot.Bot, update *models.Update, data *Item) {
+	userID := getInt(data.Data[DATA_TYPE_USERID])
+	if update.CallbackQuery.From.ID != userID {
+		return
+	}
+	challenge, err := getCaptcha(ctx, data.ChatID, userID)
+	if err != nil {
+		zap.S().Infof("[captchaCallback] no challenge for chatID=%d userID=%d: %v", data.ChatID, userID, err)
+		return
+	}
+	if int(getInt(data.Data[DATA_TYPE_INDEX])) != challenge.Answer {
+		zap.S().Infof("[captchaCallback] chatID=%d userID=%d failed the captcha", data.ChatID, userID)
+		kickUser(ctx, b, data.ChatID, userID)
+		closeCaptcha(ctx, b, challenge)
+		return
+	}
+	zap.S().Infof("[captchaCallback] chatID=%d userID=%d passed the captcha", data.ChatID, userID)
+	releaseNewcomer(ctx, b, data.ChatID, userID)
+	closeCaptcha(ctx, b, challenge)
+}
+
+// restoreDefaultPermissions gives a member the chat's default permissions.
+func restoreDefaultPermissions(ctx context.Context, b *bot.Bot, chatID, userID int64) {
+	permissions := &models.ChatPermissions{
+		CanSendMessages:       true,
+		CanSendAudios:         true,
+		CanSendDocuments:      true,
+		CanSendPhotos:         true,
+		CanSendVideos:         true,
+		CanSendVideoNotes:     true,
+		CanSendVoiceNotes:     true,
+		CanSendPolls:          true,
+		CanSendOtherMessages:  true,
+		CanAddWebPagePreviews: true,
+		CanReactToMessages:    true,
+	}
+	if chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: chatID}); err == nil && chat.Permissions != nil {
+		permissions = chat.Permissions
+	}
+	if _, err := b.RestrictChatMember(ctx, &bot.RestrictChatMemberParams{
+		ChatID:                        chatID,
+		UserID:                        userID,
+		Permissions:                   permissions,
+		UseIndependentChatPermissions: true,
+	}); err != nil {
+		zap.S().Infof("[restoreDefaultPermissions] RestrictChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+	}
+}
+
+// kickUser removes a user from the chat without banning: they may join again.
+func kickUser(ctx context.Context, b *bot.Bot, chatID, userID int64) {
+	if _, err := b.BanChatMember(ctx, &bot.BanChatMemberParams{ChatID: chatID, UserID: userID}); err != nil {
+		zap.S().Infof("[kickUser] BanChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+		return
+	}
+	if _, err := unbanUser(ctx, b, chatID, userID); err != nil {
+		zap.S().Infof("[kickUser] UnbanChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+	}
+}
+
+// closeCaptcha deletes a challenge message and its record.
+func closeCaptcha(ctx context.Context, b *bot.Bot, challenge *CaptchaChallenge) {
+	b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: challenge.ChatID, MessageID: challenge.MessageID})
+	deleteCaptcha(ctx, challenge.ChatID, challenge.UserID)
+}
+
+// expireCaptchas kicks newcomers whose challenge timed out. The challenges
+// live in the database, so those pending over a restart expire too.
+func expireCaptchas(ctx context.Context) {
+	challenges, err := getExpiredCaptchas(ctx, time.Now())
+	if err != nil {
+		zap.S().Infof("[expireCaptchas] getExpiredCaptchas failed: %v", err)
+		return
+	}
+	for _, challenge := range challenges {
+		zap.S().Infof("[expireCaptchas] chatID=%d userID=%d did not solve the captcha in time", challenge.ChatID, challenge.UserID)
+		kickUser(ctx, myBot, challenge.ChatID, challenge.UserID)
+		closeCaptcha(ctx, myBot, challenge)
+	}
+}
+
+// captchaHandler shows or switches the chat's join captcha.
+// Usage: /captcha [on [секунды] | off]
+func captchaHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	usage := "Использование: /captcha on [секунды] или /captcha off"
+
+	var enable bool
+	timeout := 0
+	switch {
+	case len(args) == 0:
+		enabled, timeout := chatCaptcha(chatID)
+		status := "выключена"
+		if enabled {
+			status = fmt.Sprintf("включена, на ответ %d секунд", timeout)
+		}
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Капча для новых участников %s\n\n%s", status, usage)), true, 60)
+		return
+	case strings.EqualFold(args[0], "on") && len(args) <= 2:
+		enable = true
+		if len(args) == 2 {
+			var err error
+			timeout, err = strconv.Atoi(args[1])
+			if err != nil || timeout < captchaMinTimeout || timeout > captchaMaxTimeout {
+				systemAnswerToMessage(ctx, b, chatID, msgID,
+					escape(fmt.Sprintf("Время на ответ — от %d до %d секунд", captchaMinTimeout, captchaMaxTimeout)), true, 30)
+				return
+			}
+		}
+	case strings.EqualFold(args[0], "off") && len(args) == 1:
+	default:
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	chatSettings.Captcha = enable
+	if timeout != 0 {
+		chatSettings.CaptchaTimeout = timeout
+	}
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[captchaHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	result := "Капча для новых участников выключена"
+	if enable {
+		_, timeout = chatCaptcha(chatID)
+		result = fmt.Sprintf("Капча для новых участников включена, на ответ %d секунд. Боту нужны права на блокировку участников", timeout)
+	}
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
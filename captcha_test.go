@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCaptcha(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		options, answer := newCaptcha(r, captchaOptions)
+		assert.Len(t, options, captchaOptions)
+		assert.Contains(t, options, answer)
+		seen := map[int]bool{}
+		for _, o := range options {
+			assert.False(t, seen[o], "duplicate option %d", o)
+			assert.True(t, o >= 0 && o < len(captchaItems))
+			seen[o] = true
+		}
+	}
+}
+
+func TestJoinedMember(t *testing.T) {
+	user := &models.User{ID: 42}
+	left := models.ChatMember{Type: models.ChatMemberTypeLeft, Left: &models.ChatMemberLeft{User: user}}
+	kicked := models.ChatMember{Type: models.ChatMemberTypeBanned, Banned: &models.ChatMemberBanned{User: user}}
+	member := models.ChatMember{Type: models.ChatMemberTypeMember, Member: &models.ChatMemberMember{User: user}}
+	restrictedIn := models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{User: user, IsMember: true}}
+	restrictedOut := models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{User: user}}
+
+	tests := []struct {
+		name     string
+		old, new models.ChatMember
+		want     *models.User
+	}{
+		{name: "join", old: left, new: member, want: user},
+		{name: "join after kick", old: kicked, new: member, want: user},
+		{name: "join while restricted", old: restrictedOut, new: member, want: user},
+		{name: "restricted rejoin", old: restrictedOut, new: restrictedIn},
+		{name: "restriction lifted", old: restrictedIn, new: member},
+		{name: "leave", old: member, new: left},
+		{name: "restricted", old: member, new: restrictedIn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upd := &models.ChatMemberUpdated{OldChatMember: tt.old, NewChatMember: tt.new}
+			assert.Equal(t, tt.want, joinedMember(upd))
+		})
+	}
+}
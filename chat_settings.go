@@ -48,6 +48,27 @@ func getChatSettings(ctx context.Context, chatId int64) (chatSettings *DynamicSe
 	return chatSettings
 }
 
+// chatLinkedChannel returns the username of the chat's linked channel, without
+// creating a settings record.
+func chatLinkedChannel(chatID int64) string {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if setting, ok := settings[chatID]; ok {
+		return setting.LinkedChannelUsername
+	}
+	return ""
+}
+
+// isLinkedChannelPost reports whether msg was posted on behalf of the chat's
+// linked channel.
+func isLinkedChannelPost(msg *models.Message) bool {
+	if msg.SenderChat == nil {
+		return false
+	}
+	linkedChannel := chatLinkedChannel(msg.Chat.ID)
+	return linkedChannel != "" && strings.EqualFold(msg.SenderChat.Username, linkedChannel)
+}
+
 func getChatNameFromSettings(chatID int64) string {
 	settingsMux.Lock()
 	defer settingsMux.Unlock()
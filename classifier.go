@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// classifierThreshold is the default spam probability, in percent, above
+	// which the classifier rule flags a message.
+	classifierThreshold = 90
+	// classifierHamSample caps how many regular messages a retrain reads, so
+	// the much larger regular history does not drown out the spam.
+	classifierHamSample = 20000
+	// classifierMinTokenCount drops tokens seen in fewer messages than this from
+	// a trained model; they carry no signal and bloat the stored document.
+	classifierMinTokenCount = 2
+	// classifierMaxTokenLen skips tokens longer than this many runes: hashes,
+	// base64 and the like.
+	classifierMaxTokenLen = 30
+)
+
+// SpamModel is a naive Bayes spam classifier trained on stored messages of
+// banned users (spam) versus everyone else (ham). Counts are per message: a
+// token repeated within one message counts once.
+type SpamModel struct {
+	ID         string `bson:"_id"`
+	SpamDocs   int
+	HamDocs    int
+	SpamTotal  int
+	HamTotal   int
+	SpamCounts map[string]int
+	HamCounts  map[string]int
+	TrainedAt  time.Time
+}
+
+// spamModelID is the _id of the model document in the classifier collection.
+const spamModelID = "spam"
+
+var (
+	spamModelMux sync.RWMutex
+	// spamModel is the current model, nil until one has been trained.
+	spamModel *SpamModel
+)
+
+// classifierTokens splits text into the distinct lower-cased words the
+// classifier works on, after the same normalization ban patterns see.
+func classifierTokens(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(normalizeText(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if n := utf8.RuneCountInString(w); n < 2 || n > classifierMaxTokenLen || seen[w] {
+			continue
+		}
+		seen[w] = true
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+// trainSpamModel builds a model from spam and ham message texts, dropping
+// tokens seen in fewer than minCount messages.
+func trainSpamModel(spam, ham []string, minCount int) *SpamModel {
+	m := &SpamModel{
+		ID:         spamModelID,
+		SpamCounts: make(map[string]int),
+		HamCounts:  make(map[string]int),
+		TrainedAt:  time.Now(),
+	}
+	for _, text := range spam {
+		if tokens := classifierTokens(text); len(tokens) != 0 {
+			m.SpamDocs++
+			for _, t := range tokens {
+				m.SpamCounts[t]++
+			}
+		}
+	}
+	for _, text := range ham {
+		if tokens := classifierTokens(text); len(tokens) != 0 {
+			m.HamDocs++
+			for _, t := range tokens {
+				m.HamCounts[t]++
+			}
+		}
+	}
+	for t := range m.SpamCounts {
+		if m.SpamCounts[t]+m.HamCounts[t] < minCount {
+			delete(m.SpamCounts, t)
+			delete(m.HamCounts, t)
+		}
+	}
+	for t := range m.HamCounts {
+		if m.SpamCounts[t]+m.HamCounts[t] < minCount {
+			delete(m.HamCounts, t)
+		}
+	}
+	for _, n := range m.SpamCounts {
+		m.SpamTotal += n
+	}
+	for _, n := range m.HamCounts {
+		m.HamTotal += n
+	}
+	return m
+}
+
+// vocabulary is the number of distinct tokens the model knows.
+func (m *SpamModel) vocabulary() int {
+	n := len(m.SpamCounts)
+	for t := range m.HamCounts {
+		if _, ok := m.SpamCounts[t]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// spamProbability returns the probability that text is spam. ok is false when
+// the model cannot tell: it lacks either class or knows none of the words.
+func (m *SpamModel) spamProbability(text string) (p float64, ok bool) {
+	if m == nil || m.SpamDocs == 0 || m.HamDocs == 0 {
+		return 0, false
+	}
+	vocabulary := float64(m.vocabulary())
+	logSpam := math.Log(float64(m.SpamDocs) / float64(m.SpamDocs+m.HamDocs))
+	logHam := math.Log(float64(m.HamDocs) / float64(m.SpamDocs+m.HamDocs))
+	known := 0
+	for _, t := range classifierTokens(text) {
+		spamCount, inSpam := m.SpamCounts[t]
+		hamCount, inHam := m.HamCounts[t]
+		if !inSpam && !inHam {
+			continue
+		}
+		known++
+		// Laplace smoothing keeps a token unseen in one class from ruling it out.
+		logSpam += math.Log((float64(spamCount) + 1) / (float64(m.SpamTotal) + vocabulary))
+		logHam += math.Log((float64(hamCount) + 1) / (float64(m.HamTotal) + vocabulary))
+	}
+	if known == 0 {
+		return 0, false
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam)), true
+}
+
+// currentSpamModel returns the model in use, nil when there is none.
+func currentSpamModel() *SpamModel {
+	spamModelMux.RLock()
+	defer spamModelMux.RUnlock()
+	return spamModel
+}
+
+// loadSpamModel reads the stored model at startup; the classifier stays idle
+// until /retrain when there is none.
+func loadSpamModel(ctx context.Context) {
+	m, err := readSpamModel(ctx)
+	if err != nil {
+		zap.S().Infof("[loadSpamModel] no spam model loaded: %v", err)
+		return
+	}
+	spamModelMux.Lock()
+	spamModel = m
+	spamModelMux.Unlock()
+	zap.S().Infof("[loadSpamModel] spam model trained at %v: spam=%d ham=%d", m.TrainedAt, m.SpamDocs, m.HamDocs)
+}
+
+// retrainSpamModel trains a model from the ban log and the stored messages,
+// stores it and puts it in use.
+func retrainSpamModel(ctx context.Context) (*SpamModel, error) {
+	bannedIDs, err := getBannedUserIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	spam, err := getTrainingTexts(ctx, bannedIDs, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	ham, err := getTrainingTexts(ctx, bannedIDs, false, classifierHamSample)
+	if err != nil {
+		return nil, err
+	}
+	m := trainSpamModel(spam, ham, classifierMinTokenCount)
+	if err := writeSpamModel(ctx, m); err != nil {
+		return nil, err
+	}
+	spamModelMux.Lock()
+	spamModel = m
+	spamModelMux.Unlock()
+	return m, nil
+}
+
+// retrainHandler retrains the spam classifier from the database.
+// Usage: /retrain
+func retrainHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.From == nil || update.Message.From.ID != superAdminID {
+		return
+	}
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape("Обучение началось"), false, 30)
+
+	go func() {
+		// Training outlives the update handler.
+		ctx := context.WithoutCancel(ctx)
+		m, err := retrainSpamModel(ctx)
+		text := fmt.Sprintf("Не удалось обучить модель: %v", err)
+		if err == nil {
+			text = fmt.Sprintf("Модель обучена: спам %d сообщений, обычных %d, слов %d",
+				m.SpamDocs, m.HamDocs, m.vocabulary())
+			zap.S().Infof("[retrainHandler] %s", text)
+		} else {
+			zap.S().Infof("[retrainHandler] retrain failed: %v", err)
+		}
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(text), true, 120)
+	}()
+}
+
+// classifierRule scores every message with the spam classifier.
+type classifierRule struct{}
+
+func (classifierRule) Name() string {
+	return "classifier"
+}
+
+func (classifierRule) Description() string {
+	return "спам по оценке классификатора, обученного на истории банов (/retrain)"
+}
+
+func (classifierRule) DefaultAction() uint8 {
+	return RULE_ACTION_REPORT
+}
+
+func (classifierRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "threshold", Default: classifierThreshold, Description: "вероятность спама в процентах, выше которой сообщение отмечается"},
+	}
+}
+
+func (classifierRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil {
+		return nil
+	}
+	text := buildStoredText(msg)
+	p, ok := currentSpamModel().spamProbability(text)
+	if !ok || p*100 <= float64(cfg.Params["threshold"]) {
+		return nil
+	}
+	return messageVerdict(msg, text, fmt.Sprintf("вероятность спама %.0f%%", p*100))
+}
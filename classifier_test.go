@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifierTokens(t *testing.T) {
+	assert.Equal(t, []string{"free", "money", "click", "here"},
+		classifierTokens("FREE money!!! click here, free money"))
+	assert.Empty(t, classifierTokens("a b c ! ?"), "one-letter words are dropped")
+	assert.Equal(t, classifierTokens("Ｆｒｅｅ mоney"), classifierTokens("free money"),
+		"text is normalized like ban patterns see it")
+}
+
+func TestSpamModel(t *testing.T) {
+	spam := []string{
+		"easy money casino bonus",
+		"casino bonus for you",
+		"money money easy crypto",
+	}
+	ham := []string{
+		"how do I configure the router",
+		"thanks for the help with the router",
+		"meeting tomorrow about the config",
+		"good morning everyone",
+	}
+	m := trainSpamModel(spam, ham, 1)
+	assert.Equal(t, 3, m.SpamDocs)
+	assert.Equal(t, 4, m.HamDocs)
+
+	p, ok := m.spamProbability("casino bonus money")
+	assert.True(t, ok)
+	assert.Greater(t, p, 0.9)
+
+	p, ok = m.spamProbability("help with the router config")
+	assert.True(t, ok)
+	assert.Less(t, p, 0.1)
+
+	_, ok = m.spamProbability("совершенно незнакомые слова")
+	assert.False(t, ok, "no known words")
+
+	var none *SpamModel
+	_, ok = none.spamProbability("casino")
+	assert.False(t, ok, "no model")
+}
+
+func TestTrainSpamModelPrunesRareTokens(t *testing.T) {
+	m := trainSpamModel([]string{"casino bonus", "casino"}, []string{"router bonus", "router"}, 2)
+	assert.Equal(t, map[string]int{"casino": 2, "bonus": 1}, m.SpamCounts)
+	assert.Equal(t, map[string]int{"router": 2, "bonus": 1}, m.HamCounts)
+	assert.Equal(t, 3, m.SpamTotal)
+	assert.Equal(t, 3, m.vocabulary())
+
+	m = trainSpamModel([]string{"casino"}, []string{"router"}, 2)
+	assert.Empty(t, m.SpamCounts)
+	assert.Empty(t, m.HamCounts)
+}
@@ -23,6 +23,15 @@ var (
 	chatMessages           *mongo.Collection
 	chatSettingsCollection *mongo.Collection
 	reactionsCollection    *mongo.Collection
+	patternListsCollection *mongo.Collection
+	patternHitsCollection  *mongo.Collection
+	classifierCollection   *mongo.Collection
+	chatMembersCollection  *mongo.Collection
+	activityCollection     *mongo.Collection
+	thanksCollection       *mongo.Collection
+	captchasCollection     *mongo.Collection
+	raidsCollection        *mongo.Collection
+	reactionKarmaLedger    *mongo.Collection
 
 	upsertOptions *options.UpdateOptions
 )
@@ -31,9 +40,11 @@ var (
 // uid - index int64
 // counter - inc counter
 // voteCounter - inc counter
+// karma - reactions to the user's messages, weighted
 
 const (
 	VOTE_RATING_MULTIPLY  = 10
+	KARMA_RATING_MULTIPLY = 2
 	CUSTOM_TAG_MIN_RATING = 200
 )
 
@@ -46,6 +57,12 @@ type UserRecord struct {
 	AltUsername string
 	MuteCounter int
 	CustomTag   string
+	Karma       int
+}
+
+// rating is the user's score: messages, frags and karma from reactions.
+func (user *UserRecord) rating() int {
+	return int(user.Counter) + int(user.VoteCounter)*VOTE_RATING_MULTIPLY + user.Karma*KARMA_RATING_MULTIPLY
 }
 
 type ChatMessage struct {
@@ -54,17 +71,69 @@ type ChatMessage struct {
 	UserID    int64
 	UserName  string
 	Text      string
-	Date      uint64
+	// NormalizedText is Text after normalizeText, the form ban patterns are
+	// matched against. After an edit it holds the latest version only.
+	NormalizedText string
+	Date           uint64
+	// ForwardOrigin is set for forwarded messages.
+	ForwardOrigin *ForwardOrigin `bson:",omitempty"`
+}
+
+// displayText is the stored text with the forward origin named, for reports.
+func (m *ChatMessage) displayText() string {
+	return withForwardOrigin(m.ForwardOrigin, m.Text)
 }
 
+// ForwardOrigin records where a forwarded message came from.
+type ForwardOrigin struct {
+	// Type is the Bot API origin type: user, hidden_user, chat or channel.
+	Type   string
+	ChatID int64
+	UserID int64
+	// Name is the @username when the origin has one, its title or name otherwise.
+	Name string
+}
+
+// ReactionRecord is a reaction UserID put on a message of AuthorID; AuthorID
+// is 0 when the message is not stored.
 type ReactionRecord struct {
 	UserID    int64  `bson:"userid"`
 	ChatID    int64  `bson:"chatid"`
 	MessageID int    `bson:"messageid"`
+	AuthorID  int64  `bson:"authorid"`
 	Emoji     string `bson:"emoji"`
 	Date      int64  `bson:"date"`
 }
 
+// ThanksRecord is a thanks FromID gave ToID for a message in a chat.
+type ThanksRecord struct {
+	ChatID    int64
+	FromID    int64
+	ToID      int64
+	MessageID int
+	Date      time.Time
+}
+
+// ReactionKarma is the karma FromID's reactions gave ToID in a chat in one
+// day; Day is the Unix day number.
+type ReactionKarma struct {
+	ChatID int64
+	FromID int64
+	ToID   int64
+	Day    int64
+	Karma  int
+}
+
+// ActivityBucket is what a user contributed to their rating in one day; Day
+// is the Unix day number.
+type ActivityBucket struct {
+	Uid      int64
+	Day      int64
+	Messages int
+	Frags    int
+	Karma    int
+}
+
 type ScoreResult struct {
 	Rating int   `bson:"rating"`
 	Userid int64 `bson:"userid"`
@@ -81,6 +150,144 @@ type DynamicSetting struct {
 	// BanPatterns are case-insensitive regexps; a message matching any of them
 	// automatically starts a ban vote against its author.
 	BanPatterns []string
+	// PatternLists are the IDs of the shared pattern lists the chat subscribes
+	// to; their patterns act exactly like the chat's own BanPatterns.
+	PatternLists []int64
+	// AllowedDomains and BlockedDomains drive the domains rule: links to a
+	// blocked domain or its subdomains are flagged unless an allowed domain
+	// matches too.
+	AllowedDomains []string
+	BlockedDomains []string
+	// AllowedForwardChannels are the channels the forwards rule lets through.
+	AllowedForwardChannels []ForwardChannel
+	// BlockedMedia are the sticker sets, custom emoji and files the media rule
+	// deletes.
+	BlockedMedia []MediaFingerprint
+	// Captcha makes users joining the chat solve a captcha within
+	// CaptchaTimeout seconds (captchaTimeout when 0) before they may post.
+	Captcha        bool
+	CaptchaTimeout int
+	// NameCheck is what to do with newcomers whose name has a link, matches
+	// one of NamePatterns or copies an admin's (NAME_CHECK_*).
+	NameCheck    uint8
+	NamePatterns []string
+	// JoinRequestVotes decides requests to join the chat by a vote.
+	JoinRequestVotes bool
+	// RaidProtection starts raid mode when more than RaidJoins users join
+	// within RaidWindow seconds (raidJoins and raidWindow when 0).
+	RaidProtection bool
+	RaidJoins      int
+	RaidWindow     int
+	// Probation limits newcomers to text until they have ProbationMessages
+	// messages or ProbationDays days in the chat (probationMessages and
+	// probationDays when 0).
+	Probation         bool
+	ProbationMessages int
+	ProbationDays     int
+	// ReactionWeights overrides the karma of reactions by emoji (see
+	// reactionWeight).
+	ReactionWeights map[string]int
+	// ThanksWords replace defaultThanksWords as the replies that thank the
+	// author when set; ThanksWordsOff leaves only /thanks.
+	ThanksWords    []string
+	ThanksWordsOff bool
+	// RatingHalfLife is the days after which activity counts half as much
+	// towards the recent rating (ratingHalfLife when 0).
+	RatingHalfLife int
+	// Rules configures the detector rules by name; rules without an entry run
+	// with their defaults.
+	Rules map[string]*RuleConfig
+}
+
+// ChatMember is a user's history in one chat. FirstSeen is when they joined
+// or first posted there; Messages, Frags, Mutes and Karma count their
+// messages, passed votes they started, mutes they got and the karma of
+// reactions to their messages there. Probation is set while
+// they are on probation, which began at ProbationSince when they had
+// ProbationBase messages.
+type ChatMember struct {
+	ChatID         int64
+	UserID         int64
+	FirstSeen      time.Time
+	Messages       int
+	Frags          int
+	Mutes          int
+	Karma          int
+	Probation      bool
+	ProbationSince time.Time
+	ProbationBase  int
+	// LastMessageID is the latest message counted in Messages.
+	LastMessageID int
+}
+
+// CaptchaChallenge is a newcomer's pending captcha: the challenge message and
+// the captchaItems index of the right button.
+type CaptchaChallenge struct {
+	ChatID    int64
+	UserID    int64
+	MessageID int
+	Answer    int
+	Deadline  time.Time
+}
+
+// Raid is a wave of joins in a chat and what the admins did about it. RaidID
+// is the Unix time it started at, unique within the chat.
+type Raid struct {
+	ChatID    int64
+	RaidID    int64
+	StartedAt time.Time
+	LastJoin  time.Time
+	EndedAt   time.Time
+	Joiners   []int64
+	Outcome   uint8
+	EndedBy   int64
+}
+
+// ForwardChannel is a channel or group identified by ID, with the name it had
+// when it was added for display.
+type ForwardChannel struct {
+	ID   int64
+	Name string
+}
+
+// The outcome of a ban pattern match, as stored in PatternHit.Outcome.
+const (
+	HIT_PENDING   uint8 = iota // the match started a vote that is still running
+	HIT_PASSED                 // the vote passed and the user was banned
+	HIT_CANCELLED              // the vote was voted down or cancelled by an admin
+	HIT_EXPIRED                // the vote expired without a decision
+	HIT_SKIPPED                // no vote: sender is an admin, already under a vote or recently banned
+)
+
+// PatternHit records one ban pattern match in a chat and what came of it.
+type PatternHit struct {
+	Pattern       string
+	ChatID        int64
+	UserID        int64
+	MessageID     int64
+	Text          string
+	VoteMessageID int64
+	Outcome       uint8
+	CreatedAt     time.Time
+}
+
+// PatternStats aggregates the hits of one pattern in a chat.
+type PatternStats struct {
+	Pattern   string    `bson:"_id"`
+	Hits      int       `bson:"hits"`
+	Passed    int       `bson:"passed"`
+	Cancelled int       `bson:"cancelled"`
+	Expired   int       `bson:"expired"`
+	Skipped   int       `bson:"skipped"`
+	LastHit   time.Time `bson:"lasthit"`
+}
+
+// PatternList is a named set of ban patterns maintained by the super admin and
+// shared by every chat subscribed to it.
+type PatternList struct {
+	ID       int64
+	Name     string
+	Patterns []string
 }
 
 func initDb(ctx context.Context, connectionLine string, dbName string) {
@@ -100,6 +307,15 @@ func initDb(ctx context.Context, connectionLine string, dbName string) {
 	chatMessages = dataBase.Collection("messages")
 	chatSettingsCollection = dataBase.Collection("settings")
 	reactionsCollection = dataBase.Collection("reactions")
+	patternListsCollection = dataBase.Collection("pattern_lists")
+	patternHitsCollection = dataBase.Collection("pattern_hits")
+	classifierCollection = dataBase.Collection("classifier")
+	chatMembersCollection = dataBase.Collection("chat_members")
+	activityCollection = dataBase.Collection("activity")
+	thanksCollection = dataBase.Collection("thanks")
+	captchasCollection = dataBase.Collection("captchas")
+	raidsCollection = dataBase.Collection("raids")
+	reactionKarmaLedger = dataBase.Collection("reaction_karma")
 	ensureIndexes(ctx)
 }
 
@@ -152,6 +368,13 @@ func ensureIndexes(ctx context.Context) {
 		zap.S().Infof("[ensureIndexes] reactions.{chatid,userid} index: %v", err)
 	}
 
+	// reactions: {chatid, date} — /likes leaderboards over a time window
+	if _, err := reactionsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "date", Value: -1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] reactions.{chatid,date} index: %v", err)
+	}
+
 	// ban_log: {chatid, votemessageid, createdat} — getBanLogByVoteMessage (filter + sort)
 	if _, err := banLogs.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "votemessageid", Value: 1}, {Key: "createdat", Value: -1}},
@@ -166,6 +389,89 @@ func ensureIndexes(ctx context.Context) {
 		zap.S().Infof("[ensureIndexes] users.voteCounter index: %v", err)
 	}
 
+	// pattern_lists: id (unique) — lists are addressed by ID from the panel
+	if _, err := patternListsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] pattern_lists.id index: %v", err)
+	}
+
+	// pattern_hits: {chatid, pattern} — getPatternStats grouping
+	if _, err := patternHitsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "pattern", Value: 1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] pattern_hits.{chatid,pattern} index: %v", err)
+	}
+
+	// pattern_hits: {chatid, votemessageid} — setPatternHitOutcome
+	if _, err := patternHitsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "votemessageid", Value: 1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] pattern_hits.{chatid,votemessageid} index: %v", err)
+	}
+
+	// chat_members: {chatid, userid} (unique) — one record per user per chat
+	if _, err := chatMembersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "chatid", Value: 1}, {Key: "userid", Value: 1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] chat_members.{chatid,userid} index: %v", err)
+	}
+
+	// activity: {uid, day} (unique) — one bucket per user per day
+	if _, err := activityCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "uid", Value: 1}, {Key: "day", Value: -1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] activity.{uid,day} index: %v", err)
+	}
+
+	// thanks: {chatid, fromid, date} — daily limit and pair cooldown lookups
+	if _, err := thanksCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "fromid", Value: 1}, {Key: "date", Value: -1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] thanks.{chatid,fromid,date} index: %v", err)
+	}
+
+	// chat_members: {chatid, frags} — getTopChatMembersByFrags sort
+	if _, err := chatMembersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "chatid", Value: 1}, {Key: "frags", Value: -1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] chat_members.{chatid,frags} index: %v", err)
+	}
+
+	// chat_members: {probation} — the probation ticker looks up members on probation
+	if _, err := chatMembersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "probation", Value: 1}},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] chat_members.{probation} index: %v", err)
+	}
+
+	// captchas: {chatid, userid} (unique) — one pending challenge per newcomer
+	if _, err := captchasCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "chatid", Value: 1}, {Key: "userid", Value: 1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] captchas.{chatid,userid} index: %v", err)
+	}
+
+	// raids: {chatid, raidid} (unique) — raid panel buttons
+	if _, err := raidsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "chatid", Value: 1}, {Key: "raidid", Value: 1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] raids.{chatid,raidid} index: %v", err)
+	}
+
+	// reaction_karma: {chatid, fromid, toid, day} (unique) — one entry per pair per day
+	if _, err := reactionKarmaLedger.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "chatid", Value: 1}, {Key: "fromid", Value: 1}, {Key: "toid", Value: 1}, {Key: "day", Value: -1}},
+		Options: &options.IndexOptions{Unique: &t},
+	}); err != nil {
+		zap.S().Infof("[ensureIndexes] reaction_karma.{chatid,fromid,toid,day} index: %v", err)
+	}
+
 	zap.S().Info("[ensureIndexes] done")
 }
 
@@ -177,6 +483,84 @@ func saveReaction(ctx context.Context, rec *ReactionRecord) {
 	}
 }
 
+// deleteUserReactions removes the reactions the user put in the chat.
+func deleteUserReactions(ctx context.Context, chatID, userID int64) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	if _, err := reactionsCollection.DeleteMany(ctx, filter); err != nil {
+		zap.S().Infof("[deleteUserReactions] DeleteMany failed for userID=%d chatID=%d: %v", userID, chatID, err)
+	}
+}
+
+// LikesRow is a /likes leaderboard line: a user and how many messages they
+// reacted to, or how many reactions from distinct users their messages got.
+type LikesRow struct {
+	UserID int64 `bson:"_id"`
+	Count  int   `bson:"count"`
+}
+
+// getLikesLeaderboard ranks the chat's users by reactions since the given
+// Unix time (all time when 0): by reactions received when byAuthor, by
+// reactions given otherwise. A user's reactions to one message count once, so
+// changing a reaction back and forth adds nothing; reactions to one's own
+// messages are not received. It returns limit rows after skip and the number
+// of ranked users.
+func getLikesLeaderboard(ctx context.Context, chatID int64, byAuthor bool, since int64, skip, limit int) ([]LikesRow, int, error) {
+	match := bson.D{{Key: "chatid", Value: chatID}}
+	if since != 0 {
+		match = append(match, bson.E{Key: "date", Value: bson.D{{Key: "$gte", Value: since}}})
+	}
+	rankBy := "$_id.userid"
+	if byAuthor {
+		// Reactions stored before authors were recorded have no authorid,
+		// which $ne would let through as a phantom user 0.
+		match = append(match,
+			bson.E{Key: "authorid", Value: bson.D{{Key: "$gt", Value: 0}}},
+			bson.E{Key: "$expr", Value: bson.D{{Key: "$ne", Value: bson.A{"$authorid", "$userid"}}}},
+		)
+		rankBy = "$_id.authorid"
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{
+			{Key: "userid", Value: "$userid"},
+			{Key: "messageid", Value: "$messageid"},
+			{Key: "authorid", Value: "$authorid"},
+		}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: rankBy},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "rows", Value: bson.A{
+				bson.D{{Key: "$skip", Value: skip}},
+				bson.D{{Key: "$limit", Value: limit}},
+			}},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "n"}}}},
+		}}},
+	}
+	cursor, err := reactionsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, fmt.Errorf("getLikesLeaderboard: %w", err)
+	}
+	var result []struct {
+		Rows  []LikesRow `bson:"rows"`
+		Total []struct {
+			N int `bson:"n"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, fmt.Errorf("getLikesLeaderboard cursor.All: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Total) == 0 {
+		return nil, 0, nil
+	}
+	return result[0].Rows, result[0].Total[0].N, nil
+}
+
 // ensureUser upserts a user record, setting uid/counters only on insert and
 // updating username/altUsername whenever non-empty values are provided.
 func ensureUser(ctx context.Context, userID int64, username, altUsername string) error {
@@ -247,6 +631,7 @@ func userPlusOneMessage(ctx context.Context, uID int64, username string, altname
 	if err != nil {
 		zap.S().Infof("[userPlusOneMessage] upsert failed for userID=%d: %v", uID, err)
 	}
+	addActivity(ctx, uID, "messages", 1)
 }
 
 func userAddMuteCounter(ctx context.Context, uID int64) error {
@@ -262,6 +647,22 @@ func userAddMuteCounter(ctx context.Context, uID int64) error {
 	return err
 }
 
+// userAddKarma adds the karma of a reaction to the user's message.
+func userAddKarma(ctx context.Context, uID int64, amount int) {
+	filter := bson.D{
+		{Key: "uid", Value: uID},
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{
+			{Key: "karma", Value: amount},
+		}},
+	}
+	if _, err := usersCollection.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[userAddKarma] upsert failed for userID=%d amount=%d: %v", uID, amount, err)
+	}
+	addActivity(ctx, uID, "karma", amount)
+}
+
 func userMakeVote(ctx context.Context, uID int64, amount int) {
 	filter := bson.D{
 		{Key: "uid", Value: uID},
@@ -275,6 +676,7 @@ func userMakeVote(ctx context.Context, uID int64, amount int) {
 	if err != nil {
 		zap.S().Infof("[userMakeVote] upsert failed for userID=%d amount=%d: %v", uID, amount, err)
 	}
+	addActivity(ctx, uID, "frags", amount)
 }
 
 // userSetCustomTag stores a user's custom chat tag; an empty tag removes it.
@@ -309,7 +711,7 @@ func getRatingFromUserID(ctx context.Context, uID int64) (score *ScoreResult, er
 	}
 
 	score = &ScoreResult{
-		Rating: int(user.Counter + user.VoteCounter*VOTE_RATING_MULTIPLY),
+		Rating: user.rating(),
 		Userid: user.Uid,
 	}
 	return score, nil
@@ -328,12 +730,288 @@ func getRatingFromUsername(ctx context.Context, username string) (score *ScoreRe
 	}
 
 	score = &ScoreResult{
-		Rating: int(user.Counter + user.VoteCounter*VOTE_RATING_MULTIPLY),
+		Rating: user.rating(),
 		Userid: user.Uid,
 	}
 	return score, nil
 }
 
+// saveThanks records a thanks.
+func saveThanks(ctx context.Context, rec *ThanksRecord) {
+	if _, err := thanksCollection.InsertOne(ctx, rec); err != nil {
+		zap.S().Infof("[saveThanks] insert failed fromID=%d toID=%d chatID=%d: %v", rec.FromID, rec.ToID, rec.ChatID, err)
+	}
+}
+
+// getThanksGivenSince returns the thanks the user gave in the chat since the
+// given time.
+func getThanksGivenSince(ctx context.Context, chatID, fromID int64, since time.Time) ([]ThanksRecord, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "fromid", Value: fromID},
+		{Key: "date", Value: bson.D{{Key: "$gte", Value: since}}},
+	}
+	cursor, err := thanksCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("getThanksGivenSince: %w", err)
+	}
+	var thanks []ThanksRecord
+	if err := cursor.All(ctx, &thanks); err != nil {
+		return nil, fmt.Errorf("getThanksGivenSince cursor.All: %w", err)
+	}
+	return thanks, nil
+}
+
+// getReactionKarma returns the karma fromID's reactions gave toID in the
+// chat on the given day.
+func getReactionKarma(ctx context.Context, chatID, fromID, toID, day int64) (int, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "fromid", Value: fromID},
+		{Key: "toid", Value: toID},
+		{Key: "day", Value: day},
+	}
+	var entry ReactionKarma
+	err := reactionKarmaLedger.FindOne(ctx, filter).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("getReactionKarma: %w", err)
+	}
+	return entry.Karma, nil
+}
+
+// addReactionKarma records karma fromID's reactions gave toID in the chat on
+// the given day.
+func addReactionKarma(ctx context.Context, chatID, fromID, toID, day int64, amount int) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "fromid", Value: fromID},
+		{Key: "toid", Value: toID},
+		{Key: "day", Value: day},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "karma", Value: amount}}}}
+	if _, err := reactionKarmaLedger.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[addReactionKarma] upsert failed fromID=%d toID=%d chatID=%d: %v", fromID, toID, chatID, err)
+	}
+}
+
+// getReactionKarmaGiven sums the karma fromID's reactions gave each member of
+// the chat, by member.
+func getReactionKarmaGiven(ctx context.Context, chatID, fromID int64) (map[int64]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "chatid", Value: chatID},
+			{Key: "fromid", Value: fromID},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$toid"},
+			{Key: "karma", Value: bson.D{{Key: "$sum", Value: "$karma"}}},
+		}}},
+	}
+	cursor, err := reactionKarmaLedger.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("getReactionKarmaGiven: %w", err)
+	}
+	var rows []struct {
+		ToID  int64 `bson:"_id"`
+		Karma int   `bson:"karma"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("getReactionKarmaGiven cursor.All: %w", err)
+	}
+	given := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		given[row.ToID] = row.Karma
+	}
+	return given, nil
+}
+
+// deleteReactionKarmaGiven removes the record of the karma fromID's reactions
+// gave in the chat.
+func deleteReactionKarmaGiven(ctx context.Context, chatID, fromID int64) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "fromid", Value: fromID},
+	}
+	if _, err := reactionKarmaLedger.DeleteMany(ctx, filter); err != nil {
+		zap.S().Infof("[deleteReactionKarmaGiven] DeleteMany failed for userID=%d chatID=%d: %v", fromID, chatID, err)
+	}
+}
+
+// dayMs is a day in milliseconds.
+const dayMs = 24 * 60 * 60 * 1000
+
+// activityDay is the Unix day number of t, the key of activity buckets.
+func activityDay(t time.Time) int64 {
+	return t.Unix() / 86400
+}
+
+// addActivity adds amount to a counter of the user's activity bucket for
+// today.
+func addActivity(ctx context.Context, uID int64, field string, amount int) {
+	filter := bson.D{
+		{Key: "uid", Value: uID},
+		{Key: "day", Value: activityDay(time.Now())},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: field, Value: amount}}}}
+	if _, err := activityCollection.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[addActivity] upsert failed for userID=%d field=%s: %v", uID, field, err)
+	}
+}
+
+// getActivity returns the user's activity buckets from the given day on.
+func getActivity(ctx context.Context, uID int64, fromDay int64) ([]ActivityBucket, error) {
+	filter := bson.D{
+		{Key: "uid", Value: uID},
+		{Key: "day", Value: bson.D{{Key: "$gte", Value: fromDay}}},
+	}
+	cursor, err := activityCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("getActivity: %w", err)
+	}
+	var buckets []ActivityBucket
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, fmt.Errorf("getActivity cursor.All: %w", err)
+	}
+	return buckets, nil
+}
+
+// seedActivity fills an empty activity collection from the dated records, so
+// the recent rating decays history by when it happened rather than from the
+// day of the first start: messages by the stored messages, frags by the votes
+// in the ban log and karma by the reactions with a known author. Reactions
+// stored before authors were recorded carry no karma, as they never did; the
+// karma weights are the defaults, not the chats' own.
+func seedActivity(ctx context.Context) {
+	if n, err := activityCollection.EstimatedDocumentCount(ctx); err != nil || n != 0 {
+		return
+	}
+	// Stored message dates are their expiry, MESSAGE_TTL_DAYS after the
+	// message was sent, in milliseconds.
+	seedActivityCounts(ctx, chatMessages, "messages", bson.D{}, "$userid",
+		bson.D{{Key: "$subtract", Value: bson.A{"$date", int64(MESSAGE_TTL_DAYS) * dayMs}}}, 1)
+	seedActivityCounts(ctx, banLogs, "frags",
+		bson.D{{Key: "type", Value: bson.D{{Key: "$in", Value: bson.A{BAN, MUTE, TEXT_ONLY}}}}}, "$ownerid",
+		bson.D{{Key: "$toLong", Value: "$createdat"}}, 1)
+
+	weights := bson.A{}
+	for emoji, weight := range defaultReactionWeights {
+		weights = append(weights, bson.D{
+			{Key: "case", Value: bson.D{{Key: "$eq", Value: bson.A{"$emoji", emoji}}}},
+			{Key: "then", Value: weight},
+		})
+	}
+	seedActivityCounts(ctx, reactionsCollection, "karma",
+		bson.D{
+			{Key: "authorid", Value: bson.D{{Key: "$gt", Value: 0}}},
+			{Key: "$expr", Value: bson.D{{Key: "$ne", Value: bson.A{"$authorid", "$userid"}}}},
+		}, "$authorid",
+		bson.D{{Key: "$multiply", Value: bson.A{"$date", 1000}}},
+		bson.D{{Key: "$switch", Value: bson.D{{Key: "branches", Value: weights}, {Key: "default", Value: defaultReactionWeight}}}})
+
+	n, _ := activityCollection.EstimatedDocumentCount(ctx)
+	zap.S().Infof("[seedActivity] seeded %d activity buckets", n)
+}
+
+// seedActivityCounts adds to the field of the activity buckets the sum of
+// amount over the source documents matching match, grouped by the user in
+// userField and the day of dateMs, a date in Unix milliseconds.
+func seedActivityCounts(ctx context.Context, source *mongo.Collection, field string, match bson.D, userField string, dateMs, amount interface{}) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "uid", Value: userField},
+				{Key: "day", Value: bson.D{{Key: "$toLong", Value: bson.D{{Key: "$floor", Value: bson.D{
+					{Key: "$divide", Value: bson.A{dateMs, dayMs}},
+				}}}}}},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: amount}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "uid", Value: "$_id.uid"},
+			{Key: "day", Value: "$_id.day"},
+			{Key: field, Value: "$count"},
+		}}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: "activity"},
+			{Key: "on", Value: bson.A{"uid", "day"}},
+			{Key: "whenMatched", Value: bson.A{bson.D{{Key: "$set", Value: bson.D{
+				{Key: field, Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$" + field, 0}}}, "$$new." + field}}}},
+			}}}}},
+			{Key: "whenNotMatched", Value: "insert"},
+		}}},
+	}
+	cursor, err := source.Aggregate(ctx, pipeline)
+	if err != nil {
+		zap.S().Infof("[seedActivityCounts] Aggregate failed for %s: %v", field, err)
+		return
+	}
+	cursor.Close(ctx)
+}
+
+// seedChatMembers fills an empty chat_members collection from the history
+// kept elsewhere, so members who were around before per-chat counting existed
+// are not taken for newcomers and /best is not empty: messages from the
+// stored messages, frags and mutes from the ban log. Logged bans count as
+// frags even if the ban itself failed.
+func seedChatMembers(ctx context.Context) {
+	if n, err := chatMembersCollection.EstimatedDocumentCount(ctx); err != nil || n != 0 {
+		return
+	}
+	// Stored message dates are their expiry, MESSAGE_TTL_DAYS after the
+	// message was sent.
+	seedChatMemberCounts(ctx, chatMessages, "messages", bson.D{}, "$userid",
+		bson.D{{Key: "$toDate", Value: bson.D{
+			{Key: "$subtract", Value: bson.A{"$date", int64(MESSAGE_TTL_DAYS) * dayMs}},
+		}}})
+	seedChatMemberCounts(ctx, banLogs, "frags",
+		bson.D{{Key: "type", Value: bson.D{{Key: "$in", Value: bson.A{BAN, MUTE, TEXT_ONLY}}}}}, "$ownerid", "$createdat")
+	seedChatMemberCounts(ctx, banLogs, "mutes",
+		bson.D{{Key: "type", Value: bson.D{{Key: "$in", Value: bson.A{MUTE, TEXT_ONLY}}}}}, "$userid", "$createdat")
+	n, _ := chatMembersCollection.EstimatedDocumentCount(ctx)
+	zap.S().Infof("[seedChatMembers] seeded %d chat members", n)
+}
+
+// seedChatMemberCounts adds to each member's field the number of the source
+// documents matching match, grouped by chat and the user in userField, and
+// moves their first seen date back to the earliest of the documents' dates.
+func seedChatMemberCounts(ctx context.Context, source *mongo.Collection, field string, match bson.D, userField string, date interface{}) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "chatid", Value: "$chatid"}, {Key: "userid", Value: userField}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "firstseen", Value: bson.D{{Key: "$min", Value: date}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "chatid", Value: "$_id.chatid"},
+			{Key: "userid", Value: "$_id.userid"},
+			{Key: field, Value: "$count"},
+			{Key: "firstseen", Value: 1},
+		}}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: "chat_members"},
+			{Key: "on", Value: bson.A{"chatid", "userid"}},
+			{Key: "whenMatched", Value: bson.A{bson.D{{Key: "$set", Value: bson.D{
+				{Key: field, Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$" + field, 0}}}, "$$new." + field}}}},
+				{Key: "firstseen", Value: bson.D{{Key: "$min", Value: bson.A{"$firstseen", "$$new.firstseen"}}}},
+			}}}}},
+			{Key: "whenNotMatched", Value: "insert"},
+		}}},
+	}
+	cursor, err := source.Aggregate(ctx, pipeline)
+	if err != nil {
+		zap.S().Infof("[seedChatMemberCounts] Aggregate failed for %s: %v", field, err)
+		return
+	}
+	cursor.Close(ctx)
+}
+
 // getUser returns the UserRecord for the given Telegram user ID from MongoDB.
 // Returns an error if the user is not in the database.
 func getUser(ctx context.Context, uID int64) (*UserRecord, error) {
@@ -409,6 +1087,7 @@ func updateMessage(ctx context.Context, message *ChatMessage) {
 						}},
 					}},
 				}},
+				{Key: "normalizedtext", Value: bson.D{{Key: "$literal", Value: message.NormalizedText}}},
 			}},
 		},
 	}
@@ -519,3 +1198,462 @@ func getUserLastDaysMessages(ctx context.Context, userID int64, chatID int64, da
 	}
 	return ret, nil
 }
+
+func readPatternLists(ctx context.Context) (ret map[int64]*PatternList) {
+	cursor, err := patternListsCollection.Find(ctx, bson.D{})
+	if err != nil {
+		zap.S().Panicf("[readPatternLists] Find failed: %v", err)
+	}
+	ret = make(map[int64]*PatternList)
+	for cursor.Next(ctx) {
+		var result PatternList
+		if err := cursor.Decode(&result); err != nil {
+			zap.S().Infof("[readPatternLists] Decode failed: %v", err)
+			continue
+		}
+		ret[result.ID] = &result
+	}
+	return ret
+}
+
+func writePatternList(ctx context.Context, list *PatternList) {
+	filter := bson.D{
+		{Key: "id", Value: list.ID},
+	}
+	update := bson.D{
+		{Key: "$set", Value: list},
+	}
+	_, err := patternListsCollection.UpdateOne(ctx, filter, update, upsertOptions)
+	if err != nil {
+		zap.S().Infof("[writePatternList] upsert failed for listID=%d: %v", list.ID, err)
+	}
+}
+
+func deletePatternList(ctx context.Context, listID int64) {
+	filter := bson.D{
+		{Key: "id", Value: listID},
+	}
+	_, err := patternListsCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		zap.S().Infof("[deletePatternList] DeleteOne failed for listID=%d: %v", listID, err)
+	}
+}
+
+func pushPatternHit(ctx context.Context, hit *PatternHit) {
+	_, err := patternHitsCollection.InsertOne(ctx, hit)
+	if err != nil {
+		zap.S().Infof("[pushPatternHit] insert failed for chatID=%d pattern=%q: %v", hit.ChatID, hit.Pattern, err)
+	}
+}
+
+// setPatternHitOutcome records how the vote started by a pattern match ended.
+func setPatternHitOutcome(ctx context.Context, chatID int64, voteMessageID int64, outcome uint8) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "votemessageid", Value: voteMessageID},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "outcome", Value: outcome}}},
+	}
+	_, err := patternHitsCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		zap.S().Infof("[setPatternHitOutcome] UpdateOne failed for chatID=%d voteMessageID=%d: %v", chatID, voteMessageID, err)
+	}
+}
+
+// getPatternStats returns per-pattern hit counts and outcomes for the chat,
+// most frequently hit first.
+func getPatternStats(ctx context.Context, chatID int64) ([]PatternStats, error) {
+	countOutcome := func(outcome uint8) bson.D {
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$eq", Value: bson.A{"$outcome", outcome}}}, 1, 0,
+		}}}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "chatid", Value: chatID}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$pattern"},
+			{Key: "hits", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "passed", Value: countOutcome(HIT_PASSED)},
+			{Key: "cancelled", Value: countOutcome(HIT_CANCELLED)},
+			{Key: "expired", Value: countOutcome(HIT_EXPIRED)},
+			{Key: "skipped", Value: countOutcome(HIT_SKIPPED)},
+			{Key: "lasthit", Value: bson.D{{Key: "$max", Value: "$createdat"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "hits", Value: -1}}}},
+	}
+	cursor, err := patternHitsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("getPatternStats: %w", err)
+	}
+	var stats []PatternStats
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, fmt.Errorf("getPatternStats cursor.All: %w", err)
+	}
+	return stats, nil
+}
+
+// getBannedUserIDs returns every user ever banned by a vote, from the ban log.
+func getBannedUserIDs(ctx context.Context) ([]int64, error) {
+	values, err := banLogs.Distinct(ctx, "userid", bson.D{{Key: "type", Value: BAN}})
+	if err != nil {
+		zap.S().Infof("[getBannedUserIDs] Distinct failed: %v", err)
+		return nil, err
+	}
+	ids := make([]int64, 0, len(values))
+	for _, v := range values {
+		switch id := v.(type) {
+		case int64:
+			ids = append(ids, id)
+		case int32:
+			ids = append(ids, int64(id))
+		}
+	}
+	return ids, nil
+}
+
+// getTrainingTexts returns the texts of stored messages whose authors are in
+// userIDs (in = true) or not in them (in = false). A positive limit takes a
+// random sample of that size.
+func getTrainingTexts(ctx context.Context, userIDs []int64, in bool, limit int) ([]string, error) {
+	op := "$nin"
+	if in {
+		op = "$in"
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "userid", Value: bson.D{{Key: op, Value: userIDs}}},
+			{Key: "text", Value: bson.D{{Key: "$ne", Value: ""}}},
+		}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: limit}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: "text", Value: 1}}}})
+	cursor, err := chatMessages.Aggregate(ctx, pipeline)
+	if err != nil {
+		zap.S().Infof("[getTrainingTexts] Aggregate failed: in=%v limit=%d: %v", in, limit, err)
+		return nil, err
+	}
+	var messages []ChatMessage
+	if err := cursor.All(ctx, &messages); err != nil {
+		zap.S().Infof("[getTrainingTexts] cursor.All failed: %v", err)
+		return nil, err
+	}
+	texts := make([]string, len(messages))
+	for i, m := range messages {
+		texts[i] = m.Text
+	}
+	return texts, nil
+}
+
+func readSpamModel(ctx context.Context) (*SpamModel, error) {
+	var m SpamModel
+	if err := classifierCollection.FindOne(ctx, bson.D{{Key: "_id", Value: spamModelID}}).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func writeSpamModel(ctx context.Context, m *SpamModel) error {
+	_, err := classifierCollection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: m.ID}}, m, options.Replace().SetUpsert(true))
+	if err != nil {
+		zap.S().Infof("[writeSpamModel] ReplaceOne failed: %v", err)
+	}
+	return err
+}
+
+// chatMemberPlusOneMessage counts a message of the user in the chat, creating
+// the member record on their first one.
+func chatMemberPlusOneMessage(ctx context.Context, chatID, userID int64, messageID int) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "messages", Value: 1}}},
+		{Key: "$max", Value: bson.D{{Key: "lastmessageid", Value: messageID}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "firstseen", Value: time.Now()}}},
+	}
+	if _, err := chatMembersCollection.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[chatMemberPlusOneMessage] UpdateOne failed for userID=%d chatID=%d: %v", userID, chatID, err)
+	}
+}
+
+// chatMemberAddFrag counts a passed vote started by the user in the chat.
+func chatMemberAddFrag(ctx context.Context, chatID, userID int64) {
+	chatMemberInc(ctx, chatID, userID, "frags", 1, "chatMemberAddFrag")
+}
+
+// chatMemberAddMute counts a mute or text-only restriction of the user in the
+// chat.
+func chatMemberAddMute(ctx context.Context, chatID, userID int64) {
+	chatMemberInc(ctx, chatID, userID, "mutes", 1, "chatMemberAddMute")
+}
+
+// chatMemberAddKarma adds the karma of a reaction to the user's message in
+// the chat.
+func chatMemberAddKarma(ctx context.Context, chatID, userID int64, amount int) {
+	chatMemberInc(ctx, chatID, userID, "karma", amount, "chatMemberAddKarma")
+}
+
+// chatMemberInc adds amount to a counter of the user's member record,
+// creating the record if needed.
+func chatMemberInc(ctx context.Context, chatID, userID int64, field string, amount int, tag string) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{{Key: field, Value: amount}}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "firstseen", Value: time.Now()}}},
+	}
+	if _, err := chatMembersCollection.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[%s] UpdateOne failed for userID=%d chatID=%d: %v", tag, userID, chatID, err)
+	}
+}
+
+// getTopChatMembersByFrags returns up to limit members of the chat with frags,
+// most frags first.
+func getTopChatMembersByFrags(ctx context.Context, chatID int64, limit int) ([]ChatMember, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "frags", Value: bson.D{{Key: "$gt", Value: 0}}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "frags", Value: -1}}).
+		SetLimit(int64(limit))
+	cursor, err := chatMembersCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("getTopChatMembersByFrags: %w", err)
+	}
+	var members []ChatMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, fmt.Errorf("getTopChatMembersByFrags cursor.All: %w", err)
+	}
+	return members, nil
+}
+
+// getUsersByIDs returns the known users among uIDs by user ID.
+func getUsersByIDs(ctx context.Context, uIDs []int64) (map[int64]*UserRecord, error) {
+	cursor, err := usersCollection.Find(ctx, bson.D{{Key: "uid", Value: bson.D{{Key: "$in", Value: uIDs}}}})
+	if err != nil {
+		return nil, fmt.Errorf("getUsersByIDs: %w", err)
+	}
+	var users []UserRecord
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("getUsersByIDs cursor.All: %w", err)
+	}
+	byID := make(map[int64]*UserRecord, len(users))
+	for i := range users {
+		byID[users[i].Uid] = &users[i]
+	}
+	return byID, nil
+}
+
+// getChatMember returns the user's record in the chat; mongo.ErrNoDocuments
+// when they have not been seen there.
+func getChatMember(ctx context.Context, chatID, userID int64) (*ChatMember, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	var member ChatMember
+	if err := chatMembersCollection.FindOne(ctx, filter).Decode(&member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// startChatMemberProbation puts the user on probation in the chat from now
+// on, creating the member record when they join.
+func startChatMemberProbation(ctx context.Context, chatID, userID int64) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	now := time.Now()
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "firstseen", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$firstseen", now}}}},
+			{Key: "messages", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$messages", 0}}}},
+			{Key: "probation", Value: true},
+			{Key: "probationsince", Value: now},
+			{Key: "probationbase", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$messages", 0}}}},
+		}}},
+	}
+	if _, err := chatMembersCollection.UpdateOne(ctx, filter, update, upsertOptions); err != nil {
+		zap.S().Infof("[startChatMemberProbation] UpdateOne failed for userID=%d chatID=%d: %v", userID, chatID, err)
+	}
+}
+
+// endChatMemberProbation takes the user off probation in the chat.
+func endChatMemberProbation(ctx context.Context, chatID, userID int64) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "probation", Value: false}}}}
+	if _, err := chatMembersCollection.UpdateOne(ctx, filter, update); err != nil {
+		zap.S().Infof("[endChatMemberProbation] UpdateOne failed for userID=%d chatID=%d: %v", userID, chatID, err)
+	}
+}
+
+// getProbationMembers returns the members on probation in every chat.
+func getProbationMembers(ctx context.Context) ([]ChatMember, error) {
+	cursor, err := chatMembersCollection.Find(ctx, bson.D{{Key: "probation", Value: true}})
+	if err != nil {
+		return nil, err
+	}
+	var members []ChatMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// saveCaptcha stores a newcomer's challenge, replacing an older one.
+func saveCaptcha(ctx context.Context, challenge *CaptchaChallenge) {
+	filter := bson.D{
+		{Key: "chatid", Value: challenge.ChatID},
+		{Key: "userid", Value: challenge.UserID},
+	}
+	if _, err := captchasCollection.ReplaceOne(ctx, filter, challenge, options.Replace().SetUpsert(true)); err != nil {
+		zap.S().Infof("[saveCaptcha] ReplaceOne failed for userID=%d chatID=%d: %v", challenge.UserID, challenge.ChatID, err)
+	}
+}
+
+// getCaptcha returns the user's pending challenge in the chat;
+// mongo.ErrNoDocuments when there is none.
+func getCaptcha(ctx context.Context, chatID, userID int64) (*CaptchaChallenge, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	var challenge CaptchaChallenge
+	if err := captchasCollection.FindOne(ctx, filter).Decode(&challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// deleteCaptcha removes the user's pending challenge in the chat.
+func deleteCaptcha(ctx context.Context, chatID, userID int64) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "userid", Value: userID},
+	}
+	if _, err := captchasCollection.DeleteOne(ctx, filter); err != nil {
+		zap.S().Infof("[deleteCaptcha] DeleteOne failed for userID=%d chatID=%d: %v", userID, chatID, err)
+	}
+}
+
+// getExpiredCaptchas returns the challenges whose deadline is before now.
+func getExpiredCaptchas(ctx context.Context, now time.Time) ([]*CaptchaChallenge, error) {
+	cursor, err := captchasCollection.Find(ctx, bson.D{{Key: "deadline", Value: bson.D{{Key: "$lt", Value: now}}}})
+	if err != nil {
+		return nil, err
+	}
+	var challenges []*CaptchaChallenge
+	if err := cursor.All(ctx, &challenges); err != nil {
+		return nil, err
+	}
+	return challenges, nil
+}
+
+// insertRaid stores a raid that just started.
+func insertRaid(ctx context.Context, raid *Raid) {
+	if _, err := raidsCollection.InsertOne(ctx, raid); err != nil {
+		zap.S().Infof("[insertRaid] InsertOne failed for chatID=%d raidID=%d: %v", raid.ChatID, raid.RaidID, err)
+	}
+}
+
+// addRaidJoiner records a user who joined the chat during the raid.
+func addRaidJoiner(ctx context.Context, chatID, raidID, userID int64, at time.Time) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "raidid", Value: raidID},
+	}
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "joiners", Value: userID}}},
+		{Key: "$set", Value: bson.D{{Key: "lastjoin", Value: at}}},
+	}
+	if _, err := raidsCollection.UpdateOne(ctx, filter, update); err != nil {
+		zap.S().Infof("[addRaidJoiner] UpdateOne failed for chatID=%d raidID=%d userID=%d: %v", chatID, raidID, userID, err)
+	}
+}
+
+// endRaid records how the raid ended and who ended it (0 when it ended on its
+// own), unless an admin has already decided on it: only a raid still active or
+// expired can end. It reports whether it did.
+func endRaid(ctx context.Context, chatID, raidID int64, outcome uint8, endedBy int64) bool {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "raidid", Value: raidID},
+		{Key: "outcome", Value: bson.D{{Key: "$in", Value: bson.A{RAID_ACTIVE, RAID_EXPIRED}}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "outcome", Value: outcome},
+		{Key: "endedby", Value: endedBy},
+		{Key: "endedat", Value: time.Now()},
+	}}}
+	result, err := raidsCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		zap.S().Infof("[endRaid] UpdateOne failed for chatID=%d raidID=%d: %v", chatID, raidID, err)
+		return false
+	}
+	return result.MatchedCount != 0
+}
+
+// getRaid returns a chat's raid; mongo.ErrNoDocuments when there is none.
+func getRaid(ctx context.Context, chatID, raidID int64) (*Raid, error) {
+	filter := bson.D{
+		{Key: "chatid", Value: chatID},
+		{Key: "raidid", Value: raidID},
+	}
+	var raid Raid
+	if err := raidsCollection.FindOne(ctx, filter).Decode(&raid); err != nil {
+		return nil, err
+	}
+	return &raid, nil
+}
+
+// getActiveRaids returns the raids still in progress.
+func getActiveRaids(ctx context.Context) ([]*Raid, error) {
+	cursor, err := raidsCollection.Find(ctx, bson.D{{Key: "outcome", Value: RAID_ACTIVE}})
+	if err != nil {
+		return nil, err
+	}
+	var raids []*Raid
+	if err := cursor.All(ctx, &raids); err != nil {
+		return nil, err
+	}
+	return raids, nil
+}
+
+// getBanLogCounts counts the user's entries in the ban log by vote type.
+func getBanLogCounts(ctx context.Context, userID int64) (map[uint8]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "userid", Value: userID}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$type"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	cursor, err := banLogs.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Type  uint8 `bson:"_id"`
+		Count int   `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[uint8]int, len(rows))
+	for _, row := range rows {
+		counts[row.Type] = row.Count
+	}
+	return counts, nil
+}
@@ -2,40 +2,23 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/ice2heart/poke_bot/cache"
 	"go.uber.org/zap"
 )
 
-// detectorCh receives all updates for spam analysis.
-var detectorCh = make(chan *models.Update, 128)
-
-const reactionTTL = 24 * time.Hour
-
 type reactionKey struct {
 	chatID int64
 	userID int64
 }
 
-type reactionEntry struct {
-	userID      int64
-	username    string
-	altUsername string
-	emoji       string
-}
-
-var reactionCache *cache.Cache[reactionKey, reactionEntry]
-
 // extractNewEmojis returns emojis added in NewReaction that were not in OldReaction.
 func extractNewEmojis(r *models.MessageReactionUpdated) (userID int64, username string, emojis []string) {
 	if r.User != nil {
@@ -61,8 +44,11 @@ func extractNewEmojis(r *models.MessageReactionUpdated) (userID int64, username
 	return
 }
 
-func processDetectorReaction(ctx context.Context, update *models.Update) {
+func processDetectorReaction(ctx context.Context, b *bot.Bot, update *models.Update) {
 	r := update.MessageReaction
+	authorID := reactionAuthor(ctx, r.Chat.ID, r.MessageID)
+	processReactionKarma(ctx, r, authorID)
+
 	userID, username, newEmojis := extractNewEmojis(r)
 	if len(newEmojis) == 0 {
 		return
@@ -71,154 +57,202 @@ func processDetectorReaction(ctx context.Context, update *models.Update) {
 		userID, username, newEmojis, r.Chat.ID, r.MessageID)
 
 	// Ensure the reacting user exists in the users collection so they can be
-	// ban-targeted later.
-	var altUsername string
+	// ban-targeted later and named in /likes.
 	if resolved, err := resolveUser(ctx, userID); err == nil {
 		zap.S().Infof("[detector] resolved userID=%d username=%q altUsername=%q", userID, resolved.Username, resolved.AltUsername)
-		username = resolved.Username
-		altUsername = resolved.AltUsername
 	} else {
 		zap.S().Infof("[detector] resolveUser failed for userID=%d: %v; falling back to update data", userID, err)
 		if r.User != nil {
-			altUsername = strings.TrimSpace(r.User.FirstName + " " + r.User.LastName)
+			altUsername := strings.TrimSpace(r.User.FirstName + " " + r.User.LastName)
 			if err := ensureUser(ctx, userID, r.User.Username, altUsername); err != nil {
 				zap.S().Infof("[detector] ensureUser fallback failed for userID=%d: %v", userID, err)
 			}
 		}
 	}
 
-	// Use the last emoji if multiple new ones; one entry per user per chat.
+	// Use the last emoji if multiple new ones.
 	emoji := newEmojis[len(newEmojis)-1]
 
 	go saveReaction(ctx, &ReactionRecord{
 		UserID:    userID,
 		ChatID:    r.Chat.ID,
 		MessageID: r.MessageID,
+		AuthorID:  authorID,
 		Emoji:     emoji,
 		Date:      int64(r.Date),
 	})
+}
 
-	reactionCache.Set(reactionKey{chatID: r.Chat.ID, userID: userID}, reactionEntry{
-		userID:      userID,
-		username:    username,
-		altUsername: altUsername,
-		emoji:       emoji,
-	}, reactionTTL)
+// banPattern is a stored ban pattern compiled twice: as typed, and with its
+// literal characters folded the way normalizeText folds message text.
+type banPattern struct {
+	raw, folded *regexp.Regexp
 }
 
-// editLinkMinDelay is the minimum edit delay (seconds) that triggers link-spam detection.
-const editLinkMinDelay = 120 // 2 minutes
+// match reports whether the pattern matches the text as sent or its
+// normalized form (norm is normalizeText(text), computed once by the caller).
+func (p *banPattern) match(text, norm string) bool {
+	return p.raw.MatchString(text) || (p.folded != nil && p.folded.MatchString(norm))
+}
 
 var (
 	patternCacheMux sync.Mutex
-	patternCache    = make(map[string]*regexp.Regexp)
+	patternCache    = make(map[string]*banPattern)
 )
 
-// compiledPattern returns the case-insensitive regexp for a stored ban pattern,
-// compiling it once and caching the result. Returns nil for invalid patterns.
-func compiledPattern(pattern string) *regexp.Regexp {
+// compileBanPattern compiles a ban pattern both as typed and folded.
+func compileBanPattern(pattern string) (*banPattern, error) {
+	raw, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+	bp := &banPattern{raw: raw}
+	// Folding only touches literals, so it should never break a valid pattern;
+	// if it does, fall back to matching the raw text only.
+	if bp.folded, err = regexp.Compile("(?i)" + foldPattern(pattern)); err != nil {
+		zap.S().Infof("[compileBanPattern] folded pattern %q invalid: %v", pattern, err)
+	}
+	return bp, nil
+}
+
+// compiledPattern returns the compiled form of a stored ban pattern, compiling
+// it once and caching the result. Returns nil for invalid patterns.
+func compiledPattern(pattern string) *banPattern {
 	patternCacheMux.Lock()
 	defer patternCacheMux.Unlock()
-	re, ok := patternCache[pattern]
+	bp, ok := patternCache[pattern]
 	if !ok {
 		var err error
-		re, err = regexp.Compile("(?i)" + pattern)
+		bp, err = compileBanPattern(pattern)
 		if err != nil {
 			zap.S().Infof("[compiledPattern] invalid pattern %q: %v", pattern, err)
-			re = nil
 		}
-		patternCache[pattern] = re
+		patternCache[pattern] = bp
+	}
+	return bp
+}
+
+// matchBanPattern returns the first pattern matching text, or "".
+func matchBanPattern(patterns []string, text string) string {
+	norm := normalizeText(text)
+	for _, p := range patterns {
+		if bp := compiledPattern(p); bp != nil && bp.match(text, norm) {
+			return p
+		}
 	}
-	return re
+	return ""
 }
 
-// chatBanPatterns returns a copy of the chat's ban patterns without creating a
-// settings record for chats (e.g. private ones) that have none.
+// chatBanPatterns returns a copy of the chat's ban patterns merged with the
+// patterns of the shared lists it subscribes to, without creating a settings
+// record for chats (e.g. private ones) that have none.
 func chatBanPatterns(chatID int64) (patterns []string, paused bool) {
 	settingsMux.Lock()
-	defer settingsMux.Unlock()
 	chatSettings, ok := settings[chatID]
 	if !ok {
+		settingsMux.Unlock()
 		return nil, false
 	}
-	return slices.Clone(chatSettings.BanPatterns), chatSettings.Pause
+	patterns = slices.Clone(chatSettings.BanPatterns)
+	listIDs := slices.Clone(chatSettings.PatternLists)
+	paused = chatSettings.Pause
+	settingsMux.Unlock()
+
+	for _, p := range subscribedPatterns(listIDs) {
+		if !slices.Contains(patterns, p) {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, paused
 }
 
-// processDetectorMessage checks a new or edited message against the chat's ban
-// patterns and automatically starts a ban vote when one matches.
-func processDetectorMessage(ctx context.Context, b *bot.Bot, msg *models.Message) {
-	if msg == nil || msg.From == nil || msg.Chat.ID >= 0 || msg.From.ID == b.ID() {
-		return
+// patternRule matches new and edited messages against the chat's ban patterns
+// and those of the shared lists it subscribes to.
+type patternRule struct{}
+
+func (patternRule) Name() string {
+	return "pattern"
+}
+
+func (patternRule) Description() string {
+	return "сообщение совпало с паттерном бана"
+}
+
+func (patternRule) DefaultAction() uint8 {
+	return RULE_ACTION_VOTE
+}
+
+func (patternRule) Params() []RuleParam {
+	return nil
+}
+
+func (patternRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil || msg.From == nil || msg.From.ID == b.ID() {
+		return nil
 	}
 
 	// Match against the same composite text that gets logged: text or caption
 	// plus sticker/GIF descriptions and hidden text-link URLs.
 	text := buildStoredText(msg)
 	if text == "" {
-		return
+		return nil
 	}
 
 	// Commands are handled by their own handlers.
 	for _, e := range msg.Entities {
 		if e.Type == models.MessageEntityTypeBotCommand && e.Offset == 0 {
-			return
+			return nil
 		}
 	}
 
-	patterns, paused := chatBanPatterns(msg.Chat.ID)
-	if paused || len(patterns) == 0 {
-		return
-	}
-
-	matched := ""
-	for _, p := range patterns {
-		if re := compiledPattern(p); re != nil && re.MatchString(text) {
-			matched = p
-			break
-		}
-	}
+	patterns, _ := chatBanPatterns(msg.Chat.ID)
+	matched := matchBanPattern(patterns, text)
 	if matched == "" {
-		return
-	}
-
-	userID := msg.From.ID
-	if msg.SenderChat != nil {
-		userID = msg.SenderChat.ID
-	}
-
-	adminsMux.Lock()
-	_, isAdmin := checkAdmins(ctx, b, msg.Chat.ID)[userID]
-	adminsMux.Unlock()
-	if isAdmin {
-		return
+		return nil
 	}
+	v := messageVerdict(msg, text, fmt.Sprintf("совпадение с паттерном %s", matched))
+	v.Pattern = matched
+	return v
+}
 
+// startDetectorVote starts a vote of the given type (BAN, MUTE, ...) against
+// userID, unless one is already running or the user was just banned.
+// targetMessageID is the message that triggered it (0 when there is none) and
+// text its content. pattern is the ban pattern that matched, empty for other
+// detector checks. ownerID is the bot for automatic votes, or the admin who
+// started the vote from a report.
+func startDetectorVote(ctx context.Context, b *bot.Bot, voteType uint8, chatID, userID, targetMessageID int64, text string, pattern string, ownerID int64) (*BanInfo, bool) {
 	sessionsMux.Lock()
-	running, _, _ := findSessionByUser(msg.Chat.ID, userID)
-	recentlyBanned := getCachedBanInfo(msg.Chat.ID, userID)
+	running, _, _ := findSessionByUser(chatID, userID)
+	recentlyBanned := getCachedBanInfo(chatID, userID)
 	sessionsMux.Unlock()
 	if running != nil || recentlyBanned {
-		return
+		return nil, false
 	}
 
-	zap.S().Infof("[detector] ban pattern %q matched: userID=%d chatID=%d messageID=%d",
-		matched, userID, msg.Chat.ID, msg.ID)
-
-	banInfo, err := getBanInfoByUserID(ctx, msg.Chat.ID, userID)
+	makeMessage := voteTypes[voteType].message
+	banInfo, err := getInfoByUserID(ctx, chatID, userID, voteType, makeMessage)
 	if err != nil {
-		zap.S().Infof("[detector] getBanInfoByUserID failed for userID=%d chatID=%d: %v", userID, msg.Chat.ID, err)
-		return
+		zap.S().Infof("[startDetectorVote] getInfoByUserID failed for userID=%d chatID=%d type=%d: %v", userID, chatID, voteType, err)
+		return nil, false
 	}
-	banInfo.TargetMessageID = int64(msg.ID)
+	banInfo.TargetMessageID = targetMessageID
 	banInfo.LastMessage = text
-	banInfo.BanMessage = makeBanMessage(banInfo)
-	// The bot itself owns automatic votes. There is no request message: the
-	// vote stands alone (linked to the target message in its text), so a
-	// cancelled or expired vote leaves the triggering message in place and
-	// only a passed ban deletes it.
-	banInfo.OwnerID = b.ID()
-
-	makeVoteMessage(ctx, banInfo, b)
+	banInfo.BanMessage = makeMessage(banInfo)
+	// There is no request message: the vote stands alone (linked to the
+	// target message in its text), so a cancelled or expired vote leaves the
+	// triggering message in place and only a passed ban deletes it.
+	banInfo.OwnerID = ownerID
+	banInfo.Pattern = pattern
+
+	if !makeVoteMessage(ctx, banInfo, b) {
+		return nil, false
+	}
+	return banInfo, true
 }
 
 // addPatternHandler adds a ban-trigger regexp to the chat settings.
@@ -308,196 +342,99 @@ func delPatternHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Паттерн удалён: %s", removed)), true, 30)
 }
 
-// startDetector runs the detection loop in a goroutine; exits when ctx is cancelled.
-func startDetector(ctx context.Context, b *bot.Bot) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case update := <-detectorCh:
-			// if data, err := json.MarshalIndent(update, "", "\t"); err == nil {
-			// 	log.Printf("[startDetector] update: %s", data)
-			// }
-			if update.Message != nil {
-				processDetectorMessage(ctx, b, update.Message)
-			}
-			if update.EditedMessage != nil {
-				processDetectorMessage(ctx, b, update.EditedMessage)
-				processDetectorEdit(ctx, b, update)
-			}
-			if update.MessageReaction != nil {
-				processDetectorReaction(ctx, update)
-			}
-		}
+// formatPatternTest reports the normalized form of text and which of the
+// patterns match it, and whether as sent or only after normalization.
+func formatPatternTest(text string, patterns []string) string {
+	norm := normalizeText(text)
+	lines := []string{
+		"Текст: " + text,
+		"Нормализованный: " + norm,
 	}
-}
-
-func processDetectorEdit(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if update.MessageReaction != nil {
-		return
-	}
-	msg := update.EditedMessage
-	if msg == nil || msg.SenderTag != "" {
-		return
+	if len(patterns) == 0 {
+		return strings.Join(append(lines, "Паттерны не настроены"), "\n")
 	}
-
-	if msg.From != nil {
-		adminsMux.Lock()
-		chatAdmins := checkAdmins(ctx, b, msg.Chat.ID)
-		adminsMux.Unlock()
-		if _, isAdmin := chatAdmins[msg.From.ID]; isAdmin {
-			return
+	matched := 0
+	for _, p := range patterns {
+		bp, err := compileBanPattern(p)
+		switch {
+		case err != nil:
+			lines = append(lines, fmt.Sprintf("%s — некорректное выражение: %v", p, err))
+		case bp.raw.MatchString(text):
+			lines = append(lines, fmt.Sprintf("%s — совпадает", p))
+			matched++
+		case bp.match(text, norm):
+			lines = append(lines, fmt.Sprintf("%s — совпадает после нормализации", p))
+			matched++
 		}
 	}
-
-	settingsMux.Lock()
-	chatSettings := getChatSettings(ctx, msg.Chat.ID)
-	settingsMux.Unlock()
-	if chatSettings.LinkedChannelUsername != "" && msg.SenderChat != nil &&
-		strings.EqualFold(msg.SenderChat.Username, chatSettings.LinkedChannelUsername) {
-		return
+	if matched == 0 {
+		lines = append(lines, "Совпадений нет")
 	}
+	return firstN(strings.Join(lines, "\n"), 3500)
+}
 
-	editDelaySec := msg.EditDate - msg.Date
-	if editDelaySec <= editLinkMinDelay {
+// testPatternHandler shows how a message is normalized and which ban patterns
+// it triggers, without starting a vote. The sample is the replied-to message
+// or the lines after the command; without a regexp the chat's own patterns
+// are tested.
+// Usage: /test_pattern [регулярное выражение] (ответом на сообщение или с текстом на следующей строке)
+func testPatternHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
 		return
 	}
 
-	for _, e := range msg.Entities {
-		if e.Type == models.MessageEntityTypeBotCommand {
-			return
-		}
-	}
-
-	hasLink := false
-	for _, e := range msg.Entities {
-		if e.Type == models.MessageEntityTypeURL || e.Type == models.MessageEntityTypeTextLink {
-			hasLink = true
-			break
-		}
+	firstLine, sample, _ := strings.Cut(update.Message.Text, "\n")
+	var pattern string
+	if parts := strings.SplitN(firstLine, " ", 2); len(parts) == 2 {
+		pattern = strings.TrimSpace(parts[1])
 	}
-	if !hasLink {
-		for _, e := range msg.CaptionEntities {
-			if e.Type == models.MessageEntityTypeURL || e.Type == models.MessageEntityTypeTextLink {
-				hasLink = true
-				break
-			}
-		}
+	if update.Message.ReplyToMessage != nil {
+		sample = buildStoredText(update.Message.ReplyToMessage)
 	}
-	if !hasLink {
+	if strings.TrimSpace(sample) == "" {
+		systemAnswerToMessage(ctx, b, chatID, msgID,
+			escape("Использование: /test_pattern [регулярное выражение] ответом на сообщение или с текстом на следующей строке"), true, 30)
 		return
 	}
 
-	zap.S().Infof("[detector] suspected spam edit: messageID=%d chatID=%d editDelaySec=%d",
-		msg.ID, msg.Chat.ID, editDelaySec)
-	if data, err := json.MarshalIndent(update, "", "\t"); err == nil {
-		zap.S().Infof("[detector] update dump: %s", data)
-	}
-
-	updatedText := msg.Text
-	if updatedText == "" {
-		updatedText = msg.Caption
+	var patterns []string
+	if pattern != "" {
+		patterns = []string{pattern}
+	} else {
+		patterns, _ = chatBanPatterns(chatID)
 	}
-
-	msgLink := fmt.Sprintf("tg://privatepost?channel=%s&post=%d",
-		makePublicGroupString(msg.Chat.ID), msg.ID)
-	text := fmt.Sprintf(
-		"Подозрительная активность: [сообщение](%s) отредактировано с добавлением ссылки спустя %d с\n\n%s",
-		msgLink, editDelaySec, quoteText(updatedText),
-	)
-
-	systemMessage(ctx, b, msg.Chat.ID, text, 5*60)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatPatternTest(sample, patterns)), true, 120)
 }
 
-const likesTopN = 10
-
-// renderLikesPage builds the text and nav keyboard for one page of the
-// reaction leaderboard. page is 0-indexed.
-func renderLikesPage(ctx context.Context, chatID int64, page int) (text string, kb *models.InlineKeyboardMarkup) {
-	entries := reactionCache.FilterSorted(func(k reactionKey) bool {
-		return k.chatID == chatID
+// startDetector runs the detector workers; returns once ctx is cancelled.
+func startDetector(ctx context.Context, b *bot.Bot) {
+	detector.run(ctx, func(update *models.Update) {
+		processDetectorUpdate(ctx, b, update)
 	})
-
-	if len(entries) == 0 {
-		return "Реакций пока нет", nil
-	}
-
-	pageCount := (len(entries) + likesTopN - 1) / likesTopN
-	if page < 0 {
-		page = 0
-	}
-	if page > pageCount-1 {
-		page = pageCount - 1
-	}
-
-	start := page * likesTopN
-	end := start + likesTopN
-	if end > len(entries) {
-		end = len(entries)
-	}
-
-	rows := make([]string, 0, end-start+1)
-	rows = append(rows, "@username \\| Имя \\| Реакция \\| Сообщений \\| Ссылка")
-	for _, e := range entries[start:end] {
-		handle := escape(e.username)
-		if handle == "" {
-			handle = "—"
-		}
-		displayName := escape(e.altUsername)
-		if displayName == "" {
-			displayName = "—"
-		}
-		messageCount := "—"
-		if user, err := getUser(ctx, e.userID); err == nil {
-			messageCount = fmt.Sprintf("%d", user.Counter)
-		}
-		rows = append(rows, fmt.Sprintf("%s \\| %s \\| %s \\| %s \\| tg://user?id\\=%d", handle, displayName, e.emoji, messageCount, e.userID))
-	}
-	rows = append(rows, fmt.Sprintf("Страница %d/%d", page+1, pageCount))
-
-	text = strings.Join(rows, "\n")
-	kb = getLikesKeyboard(chatID, page, page > 0, page < pageCount-1)
-	return text, kb
 }
 
-func likesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	chatID := update.Message.Chat.ID
-	msgID := update.Message.ID
-
-	b.DeleteMessage(ctx, &bot.DeleteMessageParams{
-		ChatID:    chatID,
-		MessageID: msgID,
-	})
-
-	text, kb := renderLikesPage(ctx, chatID, 0)
-
-	sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID:      chatID,
-		Text:        text,
-		ParseMode:   models.ParseModeMarkdown,
-		ReplyMarkup: kb,
-	})
-	if err != nil {
-		zap.S().Infof("[likesHandler] SendMessage failed chatID=%d: %v", chatID, err)
-		return
+// processDetectorUpdate runs every detector check that applies to the update.
+func processDetectorUpdate(ctx context.Context, b *bot.Bot, update *models.Update) {
+	// if data, err := json.MarshalIndent(update, "", "\t"); err == nil {
+	// 	log.Printf("[startDetector] update: %s", data)
+	// }
+	if update.MessageReaction != nil {
+		processDetectorReaction(ctx, b, update)
 	}
-	sentID := sent.ID
-	go delay(ctx, 5*60, func() {
-		b.DeleteMessage(ctx, &bot.DeleteMessageParams{
-			ChatID:    chatID,
-			MessageID: sentID,
-		})
-	})
+	runDetectorRules(ctx, b, update)
 }
 
-// detectorMiddleware feeds all message and edit updates into the detection goroutine.
+// detectorMiddleware feeds message, edit and reaction updates into the
+// detector pool in the order the bot dispatches them, then handles the update
+// in a goroutine. It must be the outermost middleware of a bot that dispatches
+// synchronously from one worker, see detectorPool.
 func detectorMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		select {
-		case detectorCh <- update:
-		default:
-			zap.S().Info("[detector] channel full, dropping update")
+		if updateChatID(update) != 0 && !detector.enqueue(ctx, update) {
+			zap.S().Infof("[detector] queue full, dropping update for chatID=%d", updateChatID(update))
 		}
-		next(ctx, b, update)
+		go next(ctx, b, update)
 	}
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDetectorWorkers   = 4
+	defaultDetectorQueueSize = 1024
+	// detectorEnqueueTimeout is how long the middleware waits for room in a
+	// full shard before dropping the update. As updates are queued from a
+	// single dispatcher, it slows all update handling down a little during a
+	// spam wave instead of losing exactly those updates.
+	detectorEnqueueTimeout = time.Second
+)
+
+// detectorPool spreads detector work over a fixed set of workers. Updates are
+// sharded by chat ID, so each chat's updates are processed in order by a
+// single worker while different chats proceed in parallel.
+//
+// The order holds because updates are queued before they go async: main has
+// the bot dispatch updates from one worker without goroutines of its own
+// (bot.WithWorkers(1), bot.WithNotAsyncHandlers), and detectorMiddleware, the
+// outermost middleware, queues each update there before it runs the rest of
+// the chain in a goroutine.
+type detectorPool struct {
+	shards    []chan *models.Update
+	timeout   time.Duration
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// detector is the pool detectorMiddleware feeds; set up in main.
+var detector *detectorPool
+
+// newDetectorPool creates a pool of workers whose shards share queueSize
+// slots between them.
+func newDetectorPool(workers, queueSize int, timeout time.Duration) *detectorPool {
+	workers = max(workers, 1)
+	perShard := max(queueSize/workers, 1)
+	p := &detectorPool{
+		shards:  make([]chan *models.Update, workers),
+		timeout: timeout,
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan *models.Update, perShard)
+	}
+	return p
+}
+
+// detectorPoolFromEnv builds the pool from DETECTOR_WORKERS and
+// DETECTOR_QUEUE_SIZE, falling back to the defaults for unset or invalid values.
+func detectorPoolFromEnv() *detectorPool {
+	envInt := func(name string, fallback int) int {
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			return fallback
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			zap.S().Infof("[detectorPoolFromEnv] invalid %s=%q, using %d", name, raw, fallback)
+			return fallback
+		}
+		return n
+	}
+	return newDetectorPool(
+		envInt("DETECTOR_WORKERS", defaultDetectorWorkers),
+		envInt("DETECTOR_QUEUE_SIZE", defaultDetectorQueueSize),
+		detectorEnqueueTimeout,
+	)
+}
+
+// updateChatID returns the chat an update belongs to, 0 for other updates.
+func updateChatID(update *models.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat.ID
+	case update.MessageReaction != nil:
+		return update.MessageReaction.Chat.ID
+	}
+	return 0
+}
+
+// shard returns the queue of the worker responsible for chatID.
+func (p *detectorPool) shard(chatID int64) chan *models.Update {
+	if chatID < 0 {
+		chatID = -chatID
+	}
+	return p.shards[chatID%int64(len(p.shards))]
+}
+
+// enqueue hands the update to its chat's worker, waiting up to the pool
+// timeout for room. It reports whether the update was queued.
+func (p *detectorPool) enqueue(ctx context.Context, update *models.Update) bool {
+	ch := p.shard(updateChatID(update))
+	select {
+	case ch <- update:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case ch <- update:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	p.dropped.Add(1)
+	return false
+}
+
+// run starts one worker per shard and blocks until ctx is cancelled and every
+// worker has returned.
+func (p *detectorPool) run(ctx context.Context, handle func(*models.Update)) {
+	var wg sync.WaitGroup
+	for _, ch := range p.shards {
+		wg.Add(1)
+		go func(ch chan *models.Update) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case update := <-ch:
+					handle(update)
+					p.processed.Add(1)
+				}
+			}
+		}(ch)
+	}
+	wg.Wait()
+}
+
+// stats formats the pool counters and the current length of every shard.
+func (p *detectorPool) stats() string {
+	lengths := make([]string, len(p.shards))
+	for i, ch := range p.shards {
+		lengths[i] = fmt.Sprintf("%d/%d", len(ch), cap(ch))
+	}
+	return fmt.Sprintf("обработано: %d, отброшено: %d, очереди: %s",
+		p.processed.Load(), p.dropped.Load(), strings.Join(lengths, " "))
+}
+
+// logDetectorStats periodically logs the pool counters.
+func logDetectorStats(ctx context.Context) {
+	zap.S().Infof("[detector] %s", detector.stats())
+}
+
+// detectorStatsHandler shows the detector pool counters to the super admin.
+// Usage: /detector_stats
+func detectorStatsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message.From == nil || update.Message.From.ID != superAdminID {
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   fmt.Sprintf("Детектор: %s", detector.stats()),
+		ReplyParameters: &models.ReplyParameters{
+			ChatID:    update.Message.Chat.ID,
+			MessageID: update.Message.ID,
+		},
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateChatID(t *testing.T) {
+	chat := models.Chat{ID: -100123}
+	assert.Equal(t, int64(-100123), updateChatID(&models.Update{Message: &models.Message{Chat: chat}}))
+	assert.Equal(t, int64(-100123), updateChatID(&models.Update{EditedMessage: &models.Message{Chat: chat}}))
+	assert.Equal(t, int64(-100123), updateChatID(&models.Update{MessageReaction: &models.MessageReactionUpdated{Chat: chat}}))
+	assert.Zero(t, updateChatID(&models.Update{CallbackQuery: &models.CallbackQuery{}}))
+}
+
+func TestDetectorPoolShardsByChat(t *testing.T) {
+	p := newDetectorPool(4, 16, time.Millisecond)
+	require.Len(t, p.shards, 4)
+	assert.Equal(t, 4, cap(p.shards[0]), "queue size is split between shards")
+
+	assert.Equal(t, p.shard(-1001234567890), p.shard(-1001234567890), "a chat always maps to the same worker")
+	assert.Equal(t, p.shard(-5), p.shard(5), "negative chat IDs are valid shard keys")
+
+	single := newDetectorPool(0, 0, time.Millisecond)
+	assert.Len(t, single.shards, 1, "at least one worker")
+	assert.Equal(t, 1, cap(single.shards[0]), "at least one slot")
+}
+
+func TestDetectorPoolDropsWhenFull(t *testing.T) {
+	p := newDetectorPool(1, 1, time.Millisecond)
+	update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: -1}}}
+
+	assert.True(t, p.enqueue(t.Context(), update))
+	assert.False(t, p.enqueue(t.Context(), update), "the only slot is taken and nobody drains it")
+	assert.Equal(t, uint64(1), p.dropped.Load())
+}
+
+func TestDetectorPoolKeepsChatOrder(t *testing.T) {
+	const perChat = 50
+	p := newDetectorPool(3, 300, time.Second)
+
+	var mu sync.Mutex
+	seen := make(map[int64][]int)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		p.run(ctx, func(update *models.Update) {
+			mu.Lock()
+			defer mu.Unlock()
+			chatID := update.Message.Chat.ID
+			seen[chatID] = append(seen[chatID], update.Message.ID)
+		})
+		close(done)
+	}()
+
+	for i := range perChat {
+		for _, chatID := range []int64{-1, -2, -3, -4} {
+			require.True(t, p.enqueue(ctx, &models.Update{Message: &models.Message{ID: i, Chat: models.Chat{ID: chatID}}}))
+		}
+	}
+	require.Eventually(t, func() bool { return p.processed.Load() == 4*perChat }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	for chatID, ids := range seen {
+		require.Len(t, ids, perChat, "chat %d", chatID)
+		for i, id := range ids {
+			assert.Equal(t, i, id, "chat %d processed out of order", chatID)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// editLinkMinDelay is the default minimum edit delay (seconds) that triggers
+// link-spam detection; chats can change it with /edit_links.
+const editLinkMinDelay = 120 // 2 minutes
+
+// lateEditRule flags links edited into messages long after they were posted:
+// spammers post something innocent and add the link once nobody looks.
+type lateEditRule struct{}
+
+func (lateEditRule) Name() string {
+	return "late_edit"
+}
+
+func (lateEditRule) Description() string {
+	return "ссылка добавлена правкой старого сообщения"
+}
+
+func (lateEditRule) DefaultAction() uint8 {
+	return RULE_ACTION_NOTICE
+}
+
+func (lateEditRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "delay", Default: editLinkMinDelay, Description: "через сколько секунд после отправки правка считается поздней"},
+	}
+}
+
+func (lateEditRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.EditedMessage
+	if msg == nil || msg.SenderTag != "" {
+		return nil
+	}
+
+	if isLinkedChannelPost(msg) {
+		return nil
+	}
+
+	editDelaySec := msg.EditDate - msg.Date
+	if editDelaySec <= cfg.Params["delay"] {
+		return nil
+	}
+
+	for _, e := range msg.Entities {
+		if e.Type == models.MessageEntityTypeBotCommand {
+			return nil
+		}
+	}
+
+	hasLink := false
+	for _, e := range msg.Entities {
+		if e.Type == models.MessageEntityTypeURL || e.Type == models.MessageEntityTypeTextLink {
+			hasLink = true
+			break
+		}
+	}
+	if !hasLink {
+		for _, e := range msg.CaptionEntities {
+			if e.Type == models.MessageEntityTypeURL || e.Type == models.MessageEntityTypeTextLink {
+				hasLink = true
+				break
+			}
+		}
+	}
+	if !hasLink {
+		return nil
+	}
+
+	zap.S().Infof("[detector] suspected spam edit: messageID=%d chatID=%d editDelaySec=%d",
+		msg.ID, msg.Chat.ID, editDelaySec)
+	if data, err := json.MarshalIndent(update, "", "\t"); err == nil {
+		zap.S().Infof("[detector] update dump: %s", data)
+	}
+
+	updatedText := msg.Text
+	if updatedText == "" {
+		updatedText = msg.Caption
+	}
+	return messageVerdict(msg, updatedText,
+		fmt.Sprintf("отредактировано с добавлением ссылки спустя %d с", editDelaySec))
+}
+
+// parseEditLinksArgs parses "<action> [seconds]". delaySec is 0 when the
+// threshold is omitted, meaning it stays unchanged.
+func parseEditLinksArgs(args string) (action uint8, delaySec int, ok bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, false
+	}
+	action, ok = parseRuleAction(fields[0])
+	if !ok {
+		return 0, 0, false
+	}
+	if len(fields) == 2 {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		delaySec = n
+	}
+	return action, delaySec, true
+}
+
+// editLinksHandler is a shortcut for configuring the late_edit rule: how the
+// chat responds to links edited into old messages and after how many seconds
+// an edit counts as late. Without arguments it shows the current settings.
+// Usage: /edit_links <notice|report|delete|vote> [секунды]
+func editLinksHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+
+	var args string
+	if parts := strings.SplitN(update.Message.Text, " ", 2); len(parts) == 2 {
+		args = parts[1]
+	}
+	action, delaySec, ok := parseEditLinksArgs(args)
+	rule := lateEditRule{}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	stored := chatSettings.Rules[rule.Name()]
+	if ok {
+		cfg := &RuleConfig{}
+		if stored != nil {
+			cfg = stored.clone()
+		}
+		cfg.Action = action
+		if delaySec > 0 {
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]int)
+			}
+			cfg.Params["delay"] = delaySec
+		}
+		if chatSettings.Rules == nil {
+			chatSettings.Rules = make(map[string]*RuleConfig)
+		}
+		chatSettings.Rules[rule.Name()] = cfg
+		settings[chatID] = chatSettings
+		writeChatSettings(ctx, chatID, chatSettings)
+		stored = cfg
+	}
+	resolved := resolveRuleConfig(rule, stored)
+	settingsMux.Unlock()
+
+	current := fmt.Sprintf("Реакция на ссылки, добавленные правкой позже %d с: %s",
+		resolved.Params["delay"], ruleActionLabel(resolved.Action))
+	if !ok {
+		usage := fmt.Sprintf("Использование: /edit_links <%s> [секунды]", ruleActionNames())
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(current+"\n"+usage), true, 60)
+		return
+	}
+	zap.S().Infof("[editLinksHandler] chatID=%d action=%d delaySec=%d set by userID=%d", chatID, action, delaySec, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(current), true, 30)
+}
+
+// banFromReport bans a user straight from a detector report, on behalf of the
+// admin who pressed the button.
+func banFromReport(ctx context.Context, b *bot.Bot, chatID, userID, messageID, adminID int64) bool {
+	sessionsMux.Lock()
+	recentlyBanned := getCachedBanInfo(chatID, userID)
+	sessionsMux.Unlock()
+	if recentlyBanned {
+		return true
+	}
+	banInfo, err := getBanInfoByUserID(ctx, chatID, userID)
+	if err != nil {
+		zap.S().Infof("[banFromReport] getBanInfoByUserID failed for userID=%d chatID=%d: %v", userID, chatID, err)
+		return false
+	}
+	banInfo.TargetMessageID = messageID
+	banInfo.OwnerID = adminID
+	return banUser(ctx, b, banInfo)
+}
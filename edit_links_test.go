@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEditLinksArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      string
+		wantOK    bool
+		wantAct   uint8
+		wantDelay int
+	}{
+		{name: "empty", args: ""},
+		{name: "action only", args: "report", wantOK: true, wantAct: RULE_ACTION_REPORT},
+		{name: "action is case-insensitive", args: "VOTE", wantOK: true, wantAct: RULE_ACTION_VOTE},
+		{name: "action with delay", args: " delete  300 ", wantOK: true, wantAct: RULE_ACTION_DELETE, wantDelay: 300},
+		{name: "unknown action", args: "kick"},
+		{name: "non-numeric delay", args: "notice soon"},
+		{name: "zero delay", args: "notice 0"},
+		{name: "too many arguments", args: "notice 10 20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, delay, ok := parseEditLinksArgs(tt.args)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantAct, action)
+			assert.Equal(t, tt.wantDelay, delay)
+		})
+	}
+}
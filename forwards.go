@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// forwardMinRating is the default for the forwards rule's min_rating: authors
+// rated below it may not forward from channels outside the allowlist.
+const forwardMinRating = 50
+
+// forwardRule flags forwards from channels and groups that are not on the
+// chat's allowlist, sent by members with a low rating.
+type forwardRule struct{}
+
+func (forwardRule) Name() string {
+	return "forwards"
+}
+
+func (forwardRule) Description() string {
+	return "пересылка из канала не из списка /forwards от участника с низким рейтингом"
+}
+
+// DefaultAction only reports: deleting forwards is left for admins to opt
+// into with /rule.
+func (forwardRule) DefaultAction() uint8 {
+	return RULE_ACTION_REPORT
+}
+
+func (forwardRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "min_rating", Default: forwardMinRating, Description: "с этого рейтинга пересылки не проверяются"},
+	}
+}
+
+func (forwardRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	// Editing never changes where a message was forwarded from.
+	msg := update.Message
+	if msg == nil || msg.IsAutomaticForward || isLinkedChannelPost(msg) {
+		return nil
+	}
+	origin := forwardOriginOf(msg)
+	if origin == nil || origin.ChatID == 0 || origin.ChatID == msg.Chat.ID {
+		return nil
+	}
+	if forwardAllowed(origin, chatForwardChannels(msg.Chat.ID), chatLinkedChannel(msg.Chat.ID)) {
+		return nil
+	}
+
+	v := messageVerdict(msg, buildStoredText(msg), "")
+	// The recent rating, so long-gone activity does not vouch for the author.
+	rating := recentRating(ctx, msg.Chat.ID, v.UserID)
+	if rating >= cfg.Params["min_rating"] {
+		return nil
+	}
+	v.Evidence = fmt.Sprintf("пересылка из %s, рейтинг автора %d", origin.Name, rating)
+	return v
+}
+
+// forwardAllowed reports whether a forward's origin is on the allowlist or is
+// the chat's linked channel.
+func forwardAllowed(origin *ForwardOrigin, allowed []ForwardChannel, linkedChannel string) bool {
+	if linkedChannel != "" && strings.EqualFold(origin.Name, "@"+linkedChannel) {
+		return true
+	}
+	return slices.ContainsFunc(allowed, func(c ForwardChannel) bool { return c.ID == origin.ChatID })
+}
+
+// chatForwardChannels returns a copy of the chat's forward allowlist without
+// creating a settings record.
+func chatForwardChannels(chatID int64) []ForwardChannel {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		return slices.Clone(chatSettings.AllowedForwardChannels)
+	}
+	return nil
+}
+
+// formatForwardChannels lists the allowlist with 1-based numbers for removal.
+func formatForwardChannels(channels []ForwardChannel) string {
+	lines := []string{"Разрешённые источники пересылок:"}
+	if len(channels) == 0 {
+		lines = append(lines, "пусто")
+	}
+	for i, c := range channels {
+		lines = append(lines, fmt.Sprintf("%d. %s (%d)", i+1, c.Name, c.ID))
+	}
+	lines = append(lines, "", "Добавить: /forwards allow @канал или ответом на пересланное сообщение",
+		"Удалить: /forwards remove <номер>")
+	return strings.Join(lines, "\n")
+}
+
+// forwardChannelFromArgs finds the channel to allow: the origin of the
+// replied-to forward, or the public channel or group named in the arguments.
+func forwardChannelFromArgs(ctx context.Context, b *bot.Bot, msg *models.Message, args []string) (ForwardChannel, error) {
+	if msg.ReplyToMessage != nil {
+		if origin := forwardOriginOf(msg.ReplyToMessage); origin != nil && origin.ChatID != 0 {
+			return ForwardChannel{ID: origin.ChatID, Name: origin.Name}, nil
+		}
+	}
+	if len(args) == 0 {
+		return ForwardChannel{}, fmt.Errorf("укажите @канал или ответьте на пересланное из канала сообщение")
+	}
+	username := strings.TrimPrefix(args[0], "@")
+	chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: "@" + username})
+	if err != nil || chat.Type == models.ChatTypePrivate {
+		return ForwardChannel{}, fmt.Errorf("канал @%s не найден", username)
+	}
+	return ForwardChannel{ID: chat.ID, Name: "@" + chat.Username}, nil
+}
+
+// forwardsHandler shows or edits the chat's forward allowlist.
+// Usage: /forwards [allow [@канал] | remove <номер>]
+func forwardsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatForwardChannels(chatForwardChannels(chatID))), true, 60)
+		return
+	}
+
+	var result string
+	switch strings.ToLower(args[0]) {
+	case "allow":
+		channel, err := forwardChannelFromArgs(ctx, b, update.Message, args[1:])
+		if err != nil {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape(err.Error()), true, 30)
+			return
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		if !slices.ContainsFunc(chatSettings.AllowedForwardChannels, func(c ForwardChannel) bool { return c.ID == channel.ID }) {
+			chatSettings.AllowedForwardChannels = append(chatSettings.AllowedForwardChannels, channel)
+			writeChatSettings(ctx, chatID, chatSettings)
+		}
+		settingsMux.Unlock()
+		result = fmt.Sprintf("Пересылки из %s разрешены", channel.Name)
+	case "remove":
+		index := 0
+		if len(args) == 2 {
+			index, _ = strconv.Atoi(args[1])
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		var removed ForwardChannel
+		if index >= 1 && index <= len(chatSettings.AllowedForwardChannels) {
+			removed = chatSettings.AllowedForwardChannels[index-1]
+			chatSettings.AllowedForwardChannels = slices.Delete(chatSettings.AllowedForwardChannels, index-1, index)
+			writeChatSettings(ctx, chatID, chatSettings)
+		}
+		settingsMux.Unlock()
+		if removed.ID == 0 {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape("Неверный номер\n\n"+formatForwardChannels(chatForwardChannels(chatID))), true, 60)
+			return
+		}
+		result = fmt.Sprintf("Пересылки из %s больше не разрешены", removed.Name)
+	default:
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatForwardChannels(chatForwardChannels(chatID))), true, 60)
+		return
+	}
+	zap.S().Infof("[forwardsHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
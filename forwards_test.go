@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardAllowed(t *testing.T) {
+	allowed := []ForwardChannel{{ID: -1001, Name: "@friends"}}
+	tests := []struct {
+		name   string
+		origin *ForwardOrigin
+		linked string
+		want   bool
+	}{
+		{name: "allowlisted by ID", origin: &ForwardOrigin{ChatID: -1001, Name: "@renamed"}, want: true},
+		{name: "linked channel", origin: &ForwardOrigin{ChatID: -1002, Name: "@OurNews"}, linked: "ournews", want: true},
+		{name: "unknown channel", origin: &ForwardOrigin{ChatID: -1003, Name: "@spam"}, linked: "ournews"},
+		{name: "no linked channel", origin: &ForwardOrigin{ChatID: -1004, Name: "@"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, forwardAllowed(tt.origin, allowed, tt.linked))
+		})
+	}
+}
+
+func TestFormatForwardChannels(t *testing.T) {
+	text := formatForwardChannels([]ForwardChannel{{ID: -1001, Name: "@friends"}, {ID: -1002, Name: "Private"}})
+	assert.Contains(t, text, "1. @friends (-1001)")
+	assert.Contains(t, text, "2. Private (-1002)")
+	assert.Contains(t, formatForwardChannels(nil), "пусто")
+}
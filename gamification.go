@@ -11,6 +11,74 @@ import (
 	"go.uber.org/zap"
 )
 
+// BEST_LIMIT is how many members /best lists.
+const BEST_LIMIT = 20
+
+// bestEntry is a /best candidate: a clickable tag and the frags to rank by.
+type bestEntry struct {
+	userID int64
+	tag    string
+	frags  int
+}
+
+// formatBestLines ranks the entries, already sorted by frags, leaving out the
+// chat's admins, and keeps the first BEST_LIMIT.
+func formatBestLines(entries []bestEntry, chatAdmins map[int64]bool) []string {
+	lines := make([]string, 0, BEST_LIMIT)
+	for _, entry := range entries {
+		if _, isAdmin := chatAdmins[entry.userID]; isAdmin {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%d\\. %s : %d", len(lines)+1, entry.tag, entry.frags))
+		if len(lines) == BEST_LIMIT {
+			break
+		}
+	}
+	return lines
+}
+
+// chatBestEntries returns the /best candidates of one chat by the frags
+// earned there.
+func chatBestEntries(ctx context.Context, chatID int64) ([]bestEntry, error) {
+	members, err := getTopChatMembersByFrags(ctx, chatID, 100)
+	if err != nil {
+		return nil, err
+	}
+	uIDs := make([]int64, 0, len(members))
+	for _, member := range members {
+		uIDs = append(uIDs, member.UserID)
+	}
+	users, err := getUsersByIDs(ctx, uIDs)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]bestEntry, 0, len(members))
+	for _, member := range members {
+		tag := fmt.Sprintf("[Пользователь вне базы](tg://user?id=%d)", member.UserID)
+		if user, ok := users[member.UserID]; ok {
+			tag = user.toClickableUsername()
+		}
+		entries = append(entries, bestEntry{userID: member.UserID, tag: tag, frags: member.Frags})
+	}
+	return entries, nil
+}
+
+// globalBestEntries returns the /best candidates across every chat by their
+// total frags.
+func globalBestEntries(ctx context.Context) ([]bestEntry, error) {
+	topUsers, err := getTopUsersByVotes(ctx, 100)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]bestEntry, 0, len(topUsers))
+	for _, user := range topUsers {
+		entries = append(entries, bestEntry{userID: user.Uid, tag: user.toClickableUsername(), frags: int(user.VoteCounter)})
+	}
+	return entries, nil
+}
+
+// bestHandler lists the chat's members with the most frags earned in it.
+// The super admin may ask for frags across every chat with /best all.
 func bestHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	chatID := update.Message.Chat.ID
 	userID := update.Message.From.ID
@@ -18,29 +86,29 @@ func bestHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if !isUserAdmin(ctx, b, chatID, userID, chatID, update.Message.ID) {
 		return
 	}
+	args := strings.Fields(update.Message.Text)[1:]
+	global := len(args) == 1 && strings.EqualFold(args[0], "all")
+	if global && userID != superAdminID {
+		systemAnswerToMessage(ctx, b, chatID, update.Message.ID, escape("Общий рейтинг по всем чатам доступен только владельцу бота"), true, 30)
+		return
+	}
 
 	adminsMux.Lock()
 	chatAdmins := checkAdmins(ctx, b, chatID)
 	adminsMux.Unlock()
 
-	topUsers, err := getTopUsersByVotes(ctx, 100)
+	var entries []bestEntry
+	var err error
+	if global {
+		entries, err = globalBestEntries(ctx)
+	} else {
+		entries, err = chatBestEntries(ctx, chatID)
+	}
 	if err != nil {
-		zap.S().Infof("[bestHandler] getTopUsersByVotes failed: %v", err)
+		zap.S().Infof("[bestHandler] chatID=%d global=%v: %v", chatID, global, err)
 		return
 	}
-
-	lines := make([]string, 0, 20)
-	rank := 1
-	for _, user := range topUsers {
-		if _, isAdmin := chatAdmins[user.Uid]; isAdmin {
-			continue
-		}
-		lines = append(lines, fmt.Sprintf("%d\\. %s : %d", rank, user.toClickableUsername(), user.VoteCounter))
-		rank++
-		if rank > 20 {
-			break
-		}
-	}
+	lines := formatBestLines(entries, chatAdmins)
 
 	b.DeleteMessage(ctx, &bot.DeleteMessageParams{
 		ChatID:    chatID,
@@ -66,20 +134,28 @@ func bestHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 const CHECK_LAST_MESSAGES = 5
 
 // formatCheckReport builds the MarkdownV2 summary for /check: the user's
-// rating breakdown and their most recent stored messages (newest first).
-func formatCheckReport(user *UserRecord, messages []ChatMessage) string {
-	rating := int(user.Counter + user.VoteCounter*VOTE_RATING_MULTIPLY)
+// rating breakdown, their recent rating under the chat's half-life, their
+// probation in the chat if any and their most recent stored messages (newest
+// first).
+func formatCheckReport(user *UserRecord, recent, halfLife int, probation string, messages []ChatMessage) string {
 	lines := []string{
 		user.toClickableUsername(),
-		fmt.Sprintf("Рейтинг: %d \\(сообщений: %d, фрагов: %d\\)", rating, user.Counter, user.VoteCounter),
+		fmt.Sprintf("Рейтинг: %d \\(сообщений: %d, фрагов: %d\\)", user.rating(), user.Counter, user.VoteCounter),
+		escape(fmt.Sprintf("Текущий рейтинг: %d (активность весит вдвое меньше каждые %d дней)", recent, halfLife)),
+	}
+	if user.Karma != 0 {
+		lines = append(lines, escape(fmt.Sprintf("Карма: %+d", user.Karma)))
 	}
 	if user.MuteCounter > 0 {
 		lines = append(lines, fmt.Sprintf("Мутов: %d", user.MuteCounter))
 	}
+	if probation != "" {
+		lines = append(lines, escape(probation))
+	}
 	if len(messages) > 0 {
 		lines = append(lines, "Последние сообщения:")
 		for _, m := range messages {
-			lines = append(lines, quoteText(firstN(m.Text, 200)))
+			lines = append(lines, quoteText(firstN(m.displayText(), 200)))
 		}
 	}
 	return firstN(strings.Join(lines, "\n"), 3500)
@@ -126,7 +202,7 @@ func checkHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if err != nil {
 		zap.S().Infof("[checkHandler] getUserLastNthMessages failed for userID=%d chatID=%d: %v", user.Uid, chatID, err)
 	}
-	systemAnswerToMessage(ctx, b, chatID, messageID, formatCheckReport(user, messages), true, 60)
+	systemAnswerToMessage(ctx, b, chatID, messageID, formatCheckReport(user, recentRating(ctx, chatID, user.Uid), chatRatingHalfLife(chatID), probationStatus(ctx, chatID, user.Uid), messages), true, 60)
 }
 
 const CUSTOM_TAG_MAX_LENGTH = 16
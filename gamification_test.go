@@ -8,25 +8,39 @@ import (
 
 func TestFormatCheckReport(t *testing.T) {
 	tests := []struct {
-		name     string
-		user     *UserRecord
-		messages []ChatMessage
-		want     string
+		name      string
+		user      *UserRecord
+		recent    int
+		probation string
+		messages  []ChatMessage
+		want      string
 	}{
 		{
-			name: "user with username and no messages",
-			user: &UserRecord{Uid: 42, Username: "bob", Counter: 100, VoteCounter: 2},
-			want: "@bob\nРейтинг: 120 \\(сообщений: 100, фрагов: 2\\)",
+			name:   "user with username and no messages",
+			user:   &UserRecord{Uid: 42, Username: "bob", Counter: 100, VoteCounter: 2},
+			recent: 37,
+			want:   "@bob\nРейтинг: 120 \\(сообщений: 100, фрагов: 2\\)\nТекущий рейтинг: 37 \\(активность весит вдвое меньше каждые 180 дней\\)",
 		},
 		{
 			name: "user without username falls back to profile link",
 			user: &UserRecord{Uid: 42, AltUsername: "John Smith", Counter: 5},
-			want: "[John Smith](tg://user?id=42)\nРейтинг: 5 \\(сообщений: 5, фрагов: 0\\)",
+			want: "[John Smith](tg://user?id=42)\nРейтинг: 5 \\(сообщений: 5, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)",
 		},
 		{
 			name: "mute counter shown when non-zero",
 			user: &UserRecord{Uid: 42, Username: "bob", Counter: 1, MuteCounter: 3},
-			want: "@bob\nРейтинг: 1 \\(сообщений: 1, фрагов: 0\\)\nМутов: 3",
+			want: "@bob\nРейтинг: 1 \\(сообщений: 1, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)\nМутов: 3",
+		},
+		{
+			name: "karma counts towards rating",
+			user: &UserRecord{Uid: 42, Username: "bob", Counter: 10, Karma: 3},
+			want: "@bob\nРейтинг: 16 \\(сообщений: 10, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)\nКарма: \\+3",
+		},
+		{
+			name:      "probation shown when given",
+			user:      &UserRecord{Uid: 42, Username: "bob", Counter: 1},
+			probation: "На испытательном сроке: осталось сообщений — 19",
+			want:      "@bob\nРейтинг: 1 \\(сообщений: 1, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)\nНа испытательном сроке: осталось сообщений — 19",
 		},
 		{
 			name: "messages quoted newest first",
@@ -35,7 +49,7 @@ func TestFormatCheckReport(t *testing.T) {
 				{Text: "second message"},
 				{Text: "first_message"},
 			},
-			want: "@bob\nРейтинг: 10 \\(сообщений: 10, фрагов: 0\\)\nПоследние сообщения:\n>second message\n>first\\_message",
+			want: "@bob\nРейтинг: 10 \\(сообщений: 10, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)\nПоследние сообщения:\n>second message\n>first\\_message",
 		},
 		{
 			name: "multiline message quoted per line",
@@ -43,12 +57,27 @@ func TestFormatCheckReport(t *testing.T) {
 			messages: []ChatMessage{
 				{Text: "line one\nline two"},
 			},
-			want: "@bob\nРейтинг: 10 \\(сообщений: 10, фрагов: 0\\)\nПоследние сообщения:\n>line one\n>line two",
+			want: "@bob\nРейтинг: 10 \\(сообщений: 10, фрагов: 0\\)\nТекущий рейтинг: 0 \\(активность весит вдвое меньше каждые 180 дней\\)\nПоследние сообщения:\n>line one\n>line two",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, formatCheckReport(tt.user, tt.messages))
+			assert.Equal(t, tt.want, formatCheckReport(tt.user, tt.recent, 180, tt.probation, tt.messages))
 		})
 	}
 }
+
+func TestFormatBestLines(t *testing.T) {
+	entries := []bestEntry{
+		{userID: 1, tag: "@admin", frags: 9},
+		{userID: 2, tag: "@bob", frags: 5},
+		{userID: 3, tag: "@eve", frags: 2},
+	}
+	assert.Equal(t, []string{"1\\. @bob : 5", "2\\. @eve : 2"}, formatBestLines(entries, map[int64]bool{1: true}))
+
+	many := make([]bestEntry, 0, BEST_LIMIT+5)
+	for i := range BEST_LIMIT + 5 {
+		many = append(many, bestEntry{userID: int64(i + 10), tag: "@user", frags: 1})
+	}
+	assert.Len(t, formatBestLines(many, nil), BEST_LIMIT)
+}
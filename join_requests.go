@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+func makeJoinRequestMessage(b *BanInfo) string {
+	bio := "не указано"
+	if b.LastMessage != "" {
+		bio = firstN(b.LastMessage, 200)
+	}
+	return fmt.Sprintf("Заявка на вступление от %s\nДля решения необходим перевес в %d голосов\nО себе:\n%s\n%s",
+		userTag(b.UserName, b.ProfileName, b.UserID), b.Score, quoteText(bio), escape(b.applicantHistory))
+}
+
+// formatApplicantHistory describes what the bot knows about a join request's
+// applicant: their activity in the chats it watches and their past bans and
+// restrictions by vote type. user is nil for someone never seen.
+func formatApplicantHistory(user *UserRecord, banCounts map[uint8]int) string {
+	labels := []struct {
+		voteType uint8
+		label    string
+	}{
+		{BAN, "банов"},
+		{MUTE, "мутов по голосованию"},
+		{TEXT_ONLY, "ограничений «только текст»"},
+	}
+	var counts []string
+	for _, l := range labels {
+		if n := banCounts[l.voteType]; n != 0 {
+			counts = append(counts, fmt.Sprintf("%s: %d", l.label, n))
+		}
+	}
+	if user == nil && len(counts) == 0 {
+		return "Бот видит пользователя впервые"
+	}
+	var lines []string
+	if user != nil {
+		lines = append(lines, fmt.Sprintf("Сообщений в чатах бота: %d, фрагов: %d, мутов: %d", user.Counter, user.VoteCounter, user.MuteCounter))
+	}
+	if len(counts) == 0 {
+		lines = append(lines, "Банов и ограничений не было")
+	} else {
+		lines = append(lines, "В журнале модерации "+strings.Join(counts, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinRequestScore is the margin of votes that decides a join request. It is
+// the reverse of the ban side: applicants with a good record in the bot's
+// chats get in easily, unknown ones need more votes, and those with bans or
+// restrictions on record need the most.
+func joinRequestScore(rating int, banCounts map[uint8]int) int16 {
+	switch {
+	case banCounts[BAN]+banCounts[MUTE]+banCounts[TEXT_ONLY] != 0:
+		return HIGH_SCORE
+	case rating < 10:
+		return MID_SCORE
+	}
+	return LOW_SCORE
+}
+
+// chatJoinRequestVotes reports whether the chat decides join requests by vote,
+// without creating a settings record.
+func chatJoinRequestVotes(chatID int64) bool {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		return chatSettings.JoinRequestVotes && !chatSettings.Pause
+	}
+	return false
+}
+
+// processJoinRequest posts a vote on a request to join a chat that decides
+// join requests by vote. Requests in other chats are left to the admins.
+func processJoinRequest(ctx context.Context, b *bot.Bot, req *models.ChatJoinRequest) {
+	chatID := req.Chat.ID
+	if !chatJoinRequestVotes(chatID) {
+		return
+	}
+	sessionsMux.Lock()
+	running, _, _ := findSessionByUser(chatID, req.From.ID)
+	sessionsMux.Unlock()
+	if running != nil {
+		return
+	}
+
+	banInfo := &BanInfo{
+		ChatID:      chatID,
+		UserID:      req.From.ID,
+		UserName:    req.From.Username,
+		ProfileName: strings.TrimSpace(req.From.FirstName + " " + req.From.LastName),
+		LastMessage: req.Bio,
+		Type:        JOIN_REQUEST,
+		// The bot itself owns join request votes, like other automatic votes.
+		OwnerID: b.ID(),
+	}
+	rating := 0
+	user, err := getUser(ctx, req.From.ID)
+	if err == nil {
+		rating = recentRating(ctx, chatID, req.From.ID)
+	} else {
+		user = nil
+	}
+	banCounts, err := getBanLogCounts(ctx, req.From.ID)
+	if err != nil {
+		zap.S().Infof("[processJoinRequest] getBanLogCounts failed for userID=%d: %v", req.From.ID, err)
+	}
+	banInfo.Score = joinRequestScore(rating, banCounts)
+	banInfo.applicantHistory = formatApplicantHistory(user, banCounts)
+	banInfo.BanMessage = makeJoinRequestMessage(banInfo)
+
+	if makeVoteMessage(ctx, banInfo, b) {
+		zap.S().Infof("[processJoinRequest] vote started for userID=%d in chatID=%d", req.From.ID, chatID)
+	}
+}
+
+// approveJoinRequest lets the applicant of a passed vote into the chat.
+func approveJoinRequest(ctx context.Context, b *bot.Bot, s *BanInfo) bool {
+	result, err := b.ApproveChatJoinRequest(ctx, &bot.ApproveChatJoinRequestParams{ChatID: s.ChatID, UserID: s.UserID})
+	if err != nil {
+		zap.S().Infof("[approveJoinRequest] ApproveChatJoinRequest failed: userID=%d chatID=%d: %v", s.UserID, s.ChatID, err)
+	}
+	finishJoinRequestVote(ctx, b, s, result, "Заявка одобрена", "Не удалось одобрить заявку")
+	return result
+}
+
+// declineJoinRequest turns down the applicant of a vote that was voted down.
+func declineJoinRequest(ctx context.Context, b *bot.Bot, s *BanInfo) {
+	result, err := b.DeclineChatJoinRequest(ctx, &bot.DeclineChatJoinRequestParams{ChatID: s.ChatID, UserID: s.UserID})
+	if err != nil {
+		zap.S().Infof("[declineJoinRequest] DeclineChatJoinRequest failed: userID=%d chatID=%d: %v", s.UserID, s.ChatID, err)
+	}
+	finishJoinRequestVote(ctx, b, s, result, "Заявка отклонена", "Не удалось отклонить заявку")
+}
+
+// expireJoinRequest hands a join request whose vote expired, or was dropped on
+// shutdown, to the admins: Telegram does not send the request again, so
+// without a word it would wait unnoticed.
+func expireJoinRequest(ctx context.Context, b *bot.Bot, s *BanInfo) {
+	pushBanLog(ctx, s)
+	zap.S().Infof("[expireJoinRequest] vote expired: userID=%d chatID=%d", s.UserID, s.ChatID)
+	report := buildModerationReport(ctx, s.ChatID, s.OwnerID,
+		escape("Голосование по заявке истекло, заявка ждёт решения администраторов в настройках чата:"), userTag(s.UserName, s.ProfileName, s.UserID))
+	sendReportToRecipients(ctx, b, s.ChatID, report,
+		&models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{showVotersButton(s.ChatID, s.VoteMessageID)}}, "expireJoinRequest")
+}
+
+// finishJoinRequestVote removes a decided join request vote, logs it for the
+// voters report and reports the outcome to the log recipients.
+func finishJoinRequestVote(ctx context.Context, b *bot.Bot, s *BanInfo, ok bool, okText, failText string) {
+	b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: s.ChatID, MessageID: int(s.VoteMessageID)})
+	pushBanLog(ctx, s)
+	resultText := okText
+	if !ok {
+		resultText = failText
+	}
+	zap.S().Infof("[finishJoinRequestVote] %s: userID=%d chatID=%d", resultText, s.UserID, s.ChatID)
+	report := buildModerationReport(ctx, s.ChatID, s.OwnerID, escape(resultText), userTag(s.UserName, s.ProfileName, s.UserID))
+	sendReportToRecipients(ctx, b, s.ChatID, report,
+		&models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{showVotersButton(s.ChatID, s.VoteMessageID)}}, "finishJoinRequestVote")
+}
+
+// joinVotesHandler switches deciding the chat's join requests by vote.
+// Usage: /join_votes [on|off]
+func joinVotesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		state := "выключено"
+		if chatJoinRequestVotes(chatID) {
+			state = "включено"
+		}
+		systemAnswerToMessage(ctx, b, chatID, msgID,
+			escape(fmt.Sprintf("Голосование по заявкам на вступление %s\n\nИспользование: /join_votes on|off", state)), true, 60)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	chatSettings.JoinRequestVotes = args[0] == "on"
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[joinVotesHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	result := "Голосование по заявкам на вступление выключено"
+	if args[0] == "on" {
+		result = "Голосование по заявкам на вступление включено. Боту нужно право добавлять участников"
+	}
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
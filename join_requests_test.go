@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatApplicantHistory(t *testing.T) {
+	user := &UserRecord{Counter: 120, VoteCounter: 2, MuteCounter: 1}
+	tests := []struct {
+		name      string
+		user      *UserRecord
+		banCounts map[uint8]int
+		want      string
+	}{
+		{name: "unknown", want: "Бот видит пользователя впервые"},
+		{name: "only join requests", banCounts: map[uint8]int{JOIN_REQUEST: 3}, want: "Бот видит пользователя впервые"},
+		{name: "clean", user: user, want: "Сообщений в чатах бота: 120, фрагов: 2, мутов: 1\nБанов и ограничений не было"},
+		{
+			name:      "banned before",
+			user:      user,
+			banCounts: map[uint8]int{BAN: 1, TEXT_ONLY: 2, JOIN_REQUEST: 1},
+			want:      "Сообщений в чатах бота: 120, фрагов: 2, мутов: 1\nВ журнале модерации банов: 1, ограничений «только текст»: 2",
+		},
+		{name: "banned, never seen", banCounts: map[uint8]int{MUTE: 1}, want: "В журнале модерации мутов по голосованию: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatApplicantHistory(tt.user, tt.banCounts))
+		})
+	}
+}
+
+func TestJoinRequestScore(t *testing.T) {
+	assert.Equal(t, MID_SCORE, joinRequestScore(0, nil), "never seen")
+	assert.Equal(t, LOW_SCORE, joinRequestScore(150, nil), "regular elsewhere")
+	assert.Equal(t, LOW_SCORE, joinRequestScore(150, map[uint8]int{JOIN_REQUEST: 2}), "past join requests do not count")
+	assert.Equal(t, HIGH_SCORE, joinRequestScore(150, map[uint8]int{MUTE: 1}), "restricted before")
+	assert.Equal(t, HIGH_SCORE, joinRequestScore(0, map[uint8]int{BAN: 1}), "banned before")
+}
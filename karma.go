@@ -0,0 +1,255 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultReactionWeight is the karma an emoji reaction gives the message
+	// author unless the chat or defaultReactionWeights says otherwise.
+	defaultReactionWeight = 1
+	// reactionWeightMin and reactionWeightMax bound what admins may set.
+	reactionWeightMin = -5
+	reactionWeightMax = 5
+	// reactionKarmaDailyCap bounds the karma, either way, one user's
+	// reactions may give another in a chat within a day.
+	reactionKarmaDailyCap = 3
+	// reactionKarmaMinMessages is how many messages a user must have written
+	// in the chat before their reactions count for karma.
+	reactionKarmaMinMessages = 10
+)
+
+// reactionKarmaMux makes reading a pair's karma for the day and adding to it
+// atomic, so quick reactions cannot both slip under the cap.
+var reactionKarmaMux sync.Mutex
+
+// defaultReactionWeights are the emojis that do not give the default karma.
+var defaultReactionWeights = map[string]int{
+	"👎": -1,
+	"💩": -1,
+	"🤮": -1,
+	"🤡": -1,
+}
+
+// chatReactionWeights returns a copy of the weights the chat set, without
+// creating a settings record.
+func chatReactionWeights(chatID int64) map[string]int {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	weights := make(map[string]int)
+	if chatSettings, ok := settings[chatID]; ok {
+		maps.Copy(weights, chatSettings.ReactionWeights)
+	}
+	return weights
+}
+
+// reactionWeight is the karma the emoji gives: the chat's weight, the
+// default one for the emoji, or defaultReactionWeight.
+func reactionWeight(weights map[string]int, emoji string) int {
+	if weight, ok := weights[emoji]; ok {
+		return weight
+	}
+	if weight, ok := defaultReactionWeights[emoji]; ok {
+		return weight
+	}
+	return defaultReactionWeight
+}
+
+// reactionKarmaDelta is how a change of one user's reactions to a message
+// changes the author's karma. Taking a reaction back takes back its karma, so
+// toggling a reaction gains nothing.
+func reactionKarmaDelta(weights map[string]int, oldReaction, newReaction []models.ReactionType) int {
+	sum := func(reactions []models.ReactionType) int {
+		total := 0
+		for _, rt := range reactions {
+			if rt.Type == models.ReactionTypeTypeEmoji && rt.ReactionTypeEmoji != nil {
+				total += reactionWeight(weights, rt.ReactionTypeEmoji.Emoji)
+			}
+		}
+		return total
+	}
+	return sum(newReaction) - sum(oldReaction)
+}
+
+// reactionAuthor returns the author of the reacted message from the stored
+// messages; 0 when the message is not stored.
+func reactionAuthor(ctx context.Context, chatID int64, messageID int) int64 {
+	message, err := getMessageInfo(ctx, chatID, int64(messageID))
+	if err != nil {
+		return 0
+	}
+	return message.UserID
+}
+
+// capReactionKarma is the part of delta that fits when the pair already
+// traded given karma today: the day's total stays within
+// [-reactionKarmaDailyCap, reactionKarmaDailyCap].
+func capReactionKarma(given, delta int) int {
+	return max(-reactionKarmaDailyCap, min(reactionKarmaDailyCap, given+delta)) - given
+}
+
+// processReactionKarma credits authorID, the author of a reacted message, with
+// the karma of the reaction. Anonymous reactions, reactions to one's own
+// messages and reactions of users with fewer than reactionKarmaMinMessages
+// messages in the chat count for nothing; the rest count up to
+// reactionKarmaDailyCap a day per pair.
+func processReactionKarma(ctx context.Context, r *models.MessageReactionUpdated, authorID int64) {
+	if r.User == nil || authorID == 0 || authorID == r.User.ID {
+		return
+	}
+	chatID, fromID := r.Chat.ID, r.User.ID
+	delta := reactionKarmaDelta(chatReactionWeights(chatID), r.OldReaction, r.NewReaction)
+	if delta == 0 {
+		return
+	}
+	member, err := getChatMember(ctx, chatID, fromID)
+	if err != nil || member.Messages < reactionKarmaMinMessages {
+		return
+	}
+
+	day := activityDay(time.Now())
+	reactionKarmaMux.Lock()
+	given, err := getReactionKarma(ctx, chatID, fromID, authorID, day)
+	if err != nil {
+		reactionKarmaMux.Unlock()
+		zap.S().Infof("[processReactionKarma] getReactionKarma failed fromID=%d toID=%d chatID=%d: %v", fromID, authorID, chatID, err)
+		return
+	}
+	delta = capReactionKarma(given, delta)
+	if delta != 0 {
+		addReactionKarma(ctx, chatID, fromID, authorID, day, delta)
+	}
+	reactionKarmaMux.Unlock()
+
+	if delta == 0 {
+		return
+	}
+	userAddKarma(ctx, authorID, delta)
+	chatMemberAddKarma(ctx, chatID, authorID, delta)
+}
+
+// revokeReactionKarma takes back the karma the user's reactions gave members
+// of the chat.
+func revokeReactionKarma(ctx context.Context, chatID, userID int64) {
+	reactionKarmaMux.Lock()
+	given, err := getReactionKarmaGiven(ctx, chatID, userID)
+	if err == nil {
+		deleteReactionKarmaGiven(ctx, chatID, userID)
+	}
+	reactionKarmaMux.Unlock()
+	if err != nil {
+		zap.S().Infof("[revokeReactionKarma] getReactionKarmaGiven failed for userID=%d chatID=%d: %v", userID, chatID, err)
+		return
+	}
+	for toID, karma := range given {
+		if karma == 0 {
+			continue
+		}
+		userAddKarma(ctx, toID, -karma)
+		chatMemberAddKarma(ctx, chatID, toID, -karma)
+	}
+	zap.S().Infof("[revokeReactionKarma] chatID=%d took back the reaction karma of userID=%d from %d members", chatID, userID, len(given))
+}
+
+// reactionEmojiMaxRunes bounds the length of a reaction emoji, long enough
+// for joined sequences such as ❤‍🔥 or 🤷‍♂️.
+const reactionEmojiMaxRunes = 8
+
+// isReactionEmoji reports whether s is a single emoji: symbols, possibly
+// joined and with variation selectors or skin tones. Anything else must not
+// become a settings key, where "$" and "." would break the write.
+func isReactionEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 || len(runes) > reactionEmojiMaxRunes || !unicode.Is(unicode.So, runes[0]) {
+		return false
+	}
+	for _, r := range runes[1:] {
+		switch {
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r):
+		case r == 0x200D, r == 0xFE0F, r == 0x20E3:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// formatReactionWeights lists the weights the chat set and the defaults it
+// did not override.
+func formatReactionWeights(weights map[string]int) string {
+	merged := maps.Clone(defaultReactionWeights)
+	maps.Copy(merged, weights)
+	emojis := slices.Sorted(maps.Keys(merged))
+	slices.SortStableFunc(emojis, func(a, b string) int {
+		return cmp.Compare(merged[b], merged[a])
+	})
+	lines := []string{fmt.Sprintf("Остальные реакции: %+d", defaultReactionWeight)}
+	for _, emoji := range emojis {
+		lines = append(lines, fmt.Sprintf("%s %+d", emoji, merged[emoji]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reactionWeightsHandler shows or sets the karma weights of reactions in the
+// chat.
+// Usage: /reaction_weights [<эмодзи> <вес> | <эмодзи> reset]
+func reactionWeightsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	usage := fmt.Sprintf("Использование: /reaction_weights <эмодзи> <вес от %d до %d> или /reaction_weights <эмодзи> reset", reactionWeightMin, reactionWeightMax)
+
+	if len(args) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID,
+			escape(fmt.Sprintf("Карма за реакции:\n%s\n\n%s", formatReactionWeights(chatReactionWeights(chatID)), usage)), true, 60)
+		return
+	}
+	if len(args) != 2 {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+	emoji := args[0]
+	if !isReactionEmoji(emoji) {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape("Укажите одну эмодзи-реакцию\n\n"+usage), true, 30)
+		return
+	}
+	reset := strings.EqualFold(args[1], "reset")
+	weight, err := strconv.Atoi(args[1])
+	if !reset && (err != nil || weight < reactionWeightMin || weight > reactionWeightMax) {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	if reset {
+		delete(chatSettings.ReactionWeights, emoji)
+	} else {
+		if chatSettings.ReactionWeights == nil {
+			chatSettings.ReactionWeights = make(map[string]int)
+		}
+		chatSettings.ReactionWeights[emoji] = weight
+	}
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[reactionWeightsHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	result := fmt.Sprintf("Карма за %s: %+d", emoji, reactionWeight(chatReactionWeights(chatID), emoji))
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
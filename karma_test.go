@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func emojiReactions(emojis ...string) []models.ReactionType {
+	reactions := make([]models.ReactionType, 0, len(emojis))
+	for _, emoji := range emojis {
+		reactions = append(reactions, models.ReactionType{
+			Type:              models.ReactionTypeTypeEmoji,
+			ReactionTypeEmoji: &models.ReactionTypeEmoji{Type: models.ReactionTypeTypeEmoji, Emoji: emoji},
+		})
+	}
+	return reactions
+}
+
+func TestReactionWeight(t *testing.T) {
+	weights := map[string]int{"🔥": 3, "👎": 0}
+	assert.Equal(t, 3, reactionWeight(weights, "🔥"))
+	assert.Equal(t, 0, reactionWeight(weights, "👎"))
+	assert.Equal(t, -1, reactionWeight(weights, "💩"))
+	assert.Equal(t, defaultReactionWeight, reactionWeight(weights, "👍"))
+}
+
+func TestReactionKarmaDelta(t *testing.T) {
+	weights := map[string]int{"🔥": 3}
+	tests := []struct {
+		name     string
+		old, new []models.ReactionType
+		want     int
+	}{
+		{name: "added", new: emojiReactions("👍"), want: 1},
+		{name: "negative", new: emojiReactions("💩"), want: -1},
+		{name: "taken back", old: emojiReactions("🔥"), want: -3},
+		{name: "replaced", old: emojiReactions("👍"), new: emojiReactions("🔥"), want: 2},
+		{name: "unchanged", old: emojiReactions("👍"), new: emojiReactions("👍")},
+		{
+			name: "custom emoji ignored",
+			new:  []models.ReactionType{{Type: models.ReactionTypeTypeCustomEmoji, ReactionTypeCustomEmoji: &models.ReactionTypeCustomEmoji{CustomEmojiID: "1"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, reactionKarmaDelta(weights, tt.old, tt.new))
+		})
+	}
+}
+
+func TestFormatReactionWeights(t *testing.T) {
+	got := formatReactionWeights(map[string]int{"🔥": 3, "🤡": 0})
+	assert.Equal(t, "Остальные реакции: +1\n🔥 +3\n🤡 +0\n👎 -1\n💩 -1\n🤮 -1", got)
+}
+
+func TestUserRating(t *testing.T) {
+	user := &UserRecord{Counter: 100, VoteCounter: 2, Karma: -5}
+	assert.Equal(t, 100+2*VOTE_RATING_MULTIPLY-5*KARMA_RATING_MULTIPLY, user.rating())
+}
+
+func TestIsReactionEmoji(t *testing.T) {
+	for _, emoji := range []string{"👍", "❤", "❤️", "🔥", "❤\u200d🔥", "🤷\u200d♂️", "👍🏽", "🆒"} {
+		assert.True(t, isReactionEmoji(emoji), emoji)
+	}
+	for _, s := range []string{"", "a", "+1", "$set", "a.b", "👍a", "👍.", "🔥🔥🔥🔥🔥🔥🔥🔥🔥"} {
+		assert.False(t, isReactionEmoji(s), s)
+	}
+}
+
+func TestCapReactionKarma(t *testing.T) {
+	assert.Equal(t, 1, capReactionKarma(0, 1))
+	assert.Equal(t, reactionKarmaDailyCap, capReactionKarma(0, 10))
+	assert.Equal(t, 0, capReactionKarma(reactionKarmaDailyCap, 1))
+	assert.Equal(t, 1, capReactionKarma(reactionKarmaDailyCap-1, 5))
+	// Taking reactions back always fits until the floor.
+	assert.Equal(t, -1, capReactionKarma(reactionKarmaDailyCap, -1))
+	assert.Equal(t, -reactionKarmaDailyCap, capReactionKarma(0, -10))
+	assert.Equal(t, 0, capReactionKarma(-reactionKarmaDailyCap, -1))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const likesTopN = 10
+
+// /likes time windows, indexes into likesWindows.
+const (
+	LIKES_DAY uint8 = iota
+	LIKES_WEEK
+	LIKES_MONTH
+	LIKES_ALL
+)
+
+// likesWindows are the /likes time windows: the command argument, the button
+// text, the title suffix and the length in days (0 for all time).
+var likesWindows = []struct {
+	arg, button, title string
+	days               int
+}{
+	LIKES_DAY:   {"day", "День", "за день", 1},
+	LIKES_WEEK:  {"week", "Неделя", "за неделю", 7},
+	LIKES_MONTH: {"month", "Месяц", "за месяц", 30},
+	LIKES_ALL:   {"all", "Всё время", "за всё время", 0},
+}
+
+// /likes views, indexes into likesViews.
+const (
+	LIKES_RECEIVED uint8 = iota
+	LIKES_GIVEN
+)
+
+// likesViews are the /likes rankings: the command argument, the button text
+// and the title.
+var likesViews = []struct {
+	arg, button, title string
+}{
+	LIKES_RECEIVED: {"received", "Получают", "Больше всех получают реакций"},
+	LIKES_GIVEN:    {"given", "Ставят", "Больше всех ставят реакции"},
+}
+
+// parseLikesArgs reads the optional window and view of /likes in any order.
+// It defaults to the week's most reacted users.
+func parseLikesArgs(args []string) (window, view uint8, ok bool) {
+	window, view = LIKES_WEEK, LIKES_RECEIVED
+	seenWindow, seenView := false, false
+next:
+	for _, arg := range args {
+		for i, w := range likesWindows {
+			if !seenWindow && strings.EqualFold(arg, w.arg) {
+				window, seenWindow = uint8(i), true
+				continue next
+			}
+		}
+		for i, v := range likesViews {
+			if !seenView && strings.EqualFold(arg, v.arg) {
+				view, seenView = uint8(i), true
+				continue next
+			}
+		}
+		return window, view, false
+	}
+	return window, view, true
+}
+
+// formatLikesRows numbers the leaderboard rows from offset+1.
+func formatLikesRows(rows []LikesRow, users map[int64]*UserRecord, offset int) []string {
+	lines := make([]string, 0, len(rows))
+	for i, row := range rows {
+		tag := fmt.Sprintf("[Пользователь вне базы](tg://user?id=%d)", row.UserID)
+		if user, ok := users[row.UserID]; ok {
+			tag = user.toClickableUsername()
+		}
+		lines = append(lines, fmt.Sprintf("%d\\. %s : %d", offset+i+1, tag, row.Count))
+	}
+	return lines
+}
+
+// renderLikesPage builds the text and keyboard for one page of the reaction
+// leaderboard. page is 0-indexed.
+func renderLikesPage(ctx context.Context, chatID int64, window, view uint8, page int) (text string, kb *models.InlineKeyboardMarkup) {
+	if int(window) >= len(likesWindows) {
+		window = LIKES_WEEK
+	}
+	if int(view) >= len(likesViews) {
+		view = LIKES_RECEIVED
+	}
+	var since int64
+	if days := likesWindows[window].days; days != 0 {
+		since = time.Now().AddDate(0, 0, -days).Unix()
+	}
+	page = max(page, 0)
+
+	rows, total, err := getLikesLeaderboard(ctx, chatID, view == LIKES_RECEIVED, since, page*likesTopN, likesTopN)
+	if err == nil && len(rows) == 0 && total > 0 {
+		// The page is gone since it was shown: go to the last one.
+		page = (total - 1) / likesTopN
+		rows, total, err = getLikesLeaderboard(ctx, chatID, view == LIKES_RECEIVED, since, page*likesTopN, likesTopN)
+	}
+	if err != nil {
+		zap.S().Infof("[renderLikesPage] chatID=%d window=%d view=%d: %v", chatID, window, view, err)
+		return "Не удалось получить реакции", nil
+	}
+
+	title := escape(fmt.Sprintf("%s %s", likesViews[view].title, likesWindows[window].title))
+	if total == 0 {
+		return fmt.Sprintf("%s\n%s", title, escape("Реакций пока нет")), getLikesKeyboard(chatID, window, view, 0, false, false)
+	}
+
+	uIDs := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		uIDs = append(uIDs, row.UserID)
+	}
+	users, err := getUsersByIDs(ctx, uIDs)
+	if err != nil {
+		zap.S().Infof("[renderLikesPage] getUsersByIDs failed for chatID=%d: %v", chatID, err)
+	}
+
+	pageCount := (total + likesTopN - 1) / likesTopN
+	lines := append([]string{title}, formatLikesRows(rows, users, page*likesTopN)...)
+	lines = append(lines, fmt.Sprintf("Страница %d/%d", page+1, pageCount))
+	return strings.Join(lines, "\n"), getLikesKeyboard(chatID, window, view, page, page > 0, page < pageCount-1)
+}
+
+// likesHandler shows the chat's reaction leaderboard.
+// Usage: /likes [day|week|month|all] [received|given]
+func likesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+
+	window, view, ok := parseLikesArgs(strings.Fields(update.Message.Text)[1:])
+	if !ok {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape("Использование: /likes [day|week|month|all] [received|given]"), true, 30)
+		return
+	}
+
+	b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+		ChatID:    chatID,
+		MessageID: msgID,
+	})
+
+	text, kb := renderLikesPage(ctx, chatID, window, view, 0)
+
+	sent, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeMarkdown,
+		ReplyMarkup: kb,
+	})
+	if err != nil {
+		zap.S().Infof("[likesHandler] SendMessage failed chatID=%d: %v", chatID, err)
+		return
+	}
+	sentID := sent.ID
+	go delay(ctx, 5*60, func() {
+		b.DeleteMessage(ctx, &bot.DeleteMessageParams{
+			ChatID:    chatID,
+			MessageID: sentID,
+		})
+	})
+}
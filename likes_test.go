@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLikesArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		window uint8
+		view   uint8
+		ok     bool
+	}{
+		{args: nil, window: LIKES_WEEK, view: LIKES_RECEIVED, ok: true},
+		{args: []string{"month"}, window: LIKES_MONTH, view: LIKES_RECEIVED, ok: true},
+		{args: []string{"given", "DAY"}, window: LIKES_DAY, view: LIKES_GIVEN, ok: true},
+		{args: []string{"all", "received"}, window: LIKES_ALL, view: LIKES_RECEIVED, ok: true},
+		{args: []string{"day", "week"}, ok: false},
+		{args: []string{"year"}, ok: false},
+	}
+	for _, tt := range tests {
+		window, view, ok := parseLikesArgs(tt.args)
+		assert.Equal(t, tt.ok, ok, tt.args)
+		if tt.ok {
+			assert.Equal(t, tt.window, window, tt.args)
+			assert.Equal(t, tt.view, view, tt.args)
+		}
+	}
+}
+
+func TestFormatLikesRows(t *testing.T) {
+	users := map[int64]*UserRecord{1: {Uid: 1, Username: "bob"}}
+	rows := []LikesRow{{UserID: 1, Count: 7}, {UserID: 2, Count: 3}}
+	assert.Equal(t, []string{
+		"11\\. @bob : 7",
+		"12\\. [Пользователь вне базы](tg://user?id=2) : 3",
+	}, formatLikesRows(rows, users, 10))
+}
+
+func TestLikesKeyboardFitsCallbackData(t *testing.T) {
+	kb := getLikesKeyboard(-1001234567890, LIKES_ALL, LIKES_GIVEN, 999, true, true)
+	assert.Len(t, kb.InlineKeyboard, 3)
+	for _, row := range kb.InlineKeyboard {
+		for _, button := range row {
+			assert.LessOrEqual(t, len(button.CallbackData), 64, button.Text)
+		}
+	}
+}
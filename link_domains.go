@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// linkDomainRule flags links to domains on the chat's blocklist, in visible
+// URLs as well as in text links hiding their target behind other text.
+type linkDomainRule struct{}
+
+func (linkDomainRule) Name() string {
+	return "domains"
+}
+
+func (linkDomainRule) Description() string {
+	return "ссылка на домен из чёрного списка чата (/domains)"
+}
+
+func (linkDomainRule) DefaultAction() uint8 {
+	return RULE_ACTION_DELETE
+}
+
+func (linkDomainRule) Params() []RuleParam {
+	return nil
+}
+
+func (linkDomainRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil || isLinkedChannelPost(msg) {
+		return nil
+	}
+	allowed, blocked := chatDomainLists(msg.Chat.ID)
+	if len(blocked) == 0 {
+		return nil
+	}
+	host, domain := findBlockedLink(messageURLs(msg), allowed, blocked)
+	if host == "" {
+		return nil
+	}
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	return messageVerdict(msg, text, fmt.Sprintf("ссылка на %s, домен %s в чёрном списке", host, domain))
+}
+
+// messageURLs returns every link in a message: visible URL entities and the
+// hidden targets of text links, in the text and in the caption, and the links
+// behind inline buttons.
+func messageURLs(msg *models.Message) []string {
+	var urls []string
+	for _, src := range []struct {
+		text     string
+		entities []models.MessageEntity
+	}{
+		{msg.Text, msg.Entities},
+		{msg.Caption, msg.CaptionEntities},
+	} {
+		for _, e := range src.entities {
+			if e.Type == models.MessageEntityTypeURL {
+				urls = append(urls, entityText(src.text, e.Offset, e.Length))
+			}
+		}
+	}
+	urls = append(urls, collectHiddenURLs(msg.Entities, msg.CaptionEntities)...)
+	if msg.ReplyMarkup != nil {
+		for _, row := range msg.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.URL != "" {
+					urls = append(urls, button.URL)
+				}
+			}
+		}
+	}
+	return urls
+}
+
+// urlHost returns the lower-cased host of a link, which may lack a scheme as
+// URL entities often do. It returns "" when there is no host.
+func urlHost(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// normalizeDomain turns an admin-supplied domain, possibly given as a link or
+// with a "www." or "*." prefix, into the form stored in the domain lists.
+func normalizeDomain(s string) (string, bool) {
+	host := urlHost(s)
+	host = strings.TrimPrefix(host, "*.")
+	host = strings.TrimPrefix(host, "www.")
+	if host == "" || !strings.Contains(host, ".") || strings.ContainsAny(host, "*/") {
+		return "", false
+	}
+	return host, true
+}
+
+// matchDomain returns the entry of domains that host equals or is a
+// subdomain of.
+func matchDomain(host string, domains []string) (string, bool) {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// findBlockedLink returns the host of the first link pointing at a blocked
+// domain and the blocklist entry it matched. Allowed domains always win, so a
+// chat can block a domain while allowing one of its subdomains.
+func findBlockedLink(urls, allowed, blocked []string) (host, domain string) {
+	for _, raw := range urls {
+		h := urlHost(raw)
+		if h == "" {
+			continue
+		}
+		if _, ok := matchDomain(h, allowed); ok {
+			continue
+		}
+		if d, ok := matchDomain(h, blocked); ok {
+			return h, d
+		}
+	}
+	return "", ""
+}
+
+// chatDomainLists returns copies of the chat's domain lists without creating
+// a settings record.
+func chatDomainLists(chatID int64) (allowed, blocked []string) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	chatSettings, ok := settings[chatID]
+	if !ok {
+		return nil, nil
+	}
+	return slices.Clone(chatSettings.AllowedDomains), slices.Clone(chatSettings.BlockedDomains)
+}
+
+// applyDomainCommand applies "allow|block|remove <домен>" to the chat's
+// domain lists. A domain is on at most one list: allowing a blocked domain
+// moves it to the allowlist and vice versa.
+func applyDomainCommand(chatSettings *DynamicSetting, args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("укажите команду и домен")
+	}
+	domain, ok := normalizeDomain(args[1])
+	if !ok {
+		return "", fmt.Errorf("некорректный домен %q", args[1])
+	}
+	without := func(list []string) []string {
+		return slices.DeleteFunc(list, func(d string) bool { return d == domain })
+	}
+	switch strings.ToLower(args[0]) {
+	case "allow":
+		chatSettings.BlockedDomains = without(chatSettings.BlockedDomains)
+		if !slices.Contains(chatSettings.AllowedDomains, domain) {
+			chatSettings.AllowedDomains = append(chatSettings.AllowedDomains, domain)
+		}
+		return fmt.Sprintf("Домен %s разрешён", domain), nil
+	case "block":
+		chatSettings.AllowedDomains = without(chatSettings.AllowedDomains)
+		if !slices.Contains(chatSettings.BlockedDomains, domain) {
+			chatSettings.BlockedDomains = append(chatSettings.BlockedDomains, domain)
+		}
+		return fmt.Sprintf("Домен %s заблокирован", domain), nil
+	case "remove":
+		if !slices.Contains(chatSettings.AllowedDomains, domain) && !slices.Contains(chatSettings.BlockedDomains, domain) {
+			return "", fmt.Errorf("домена %s нет в списках", domain)
+		}
+		chatSettings.AllowedDomains = without(chatSettings.AllowedDomains)
+		chatSettings.BlockedDomains = without(chatSettings.BlockedDomains)
+		return fmt.Sprintf("Домен %s удалён из списков", domain), nil
+	}
+	return "", fmt.Errorf("неизвестная команда %q", args[0])
+}
+
+// formatDomainLists describes the chat's domain lists in plain text.
+func formatDomainLists(allowed, blocked []string) string {
+	list := func(domains []string) string {
+		if len(domains) == 0 {
+			return "пусто"
+		}
+		return strings.Join(domains, ", ")
+	}
+	return fmt.Sprintf("Разрешённые домены: %s\nЗаблокированные домены: %s\n\n"+
+		"Настройка: /domains allow|block|remove <домен>, реакция: /rule domains action <%s>",
+		list(allowed), list(blocked), ruleActionNames())
+}
+
+// domainsHandler shows or edits the chat's link domain lists.
+// Usage: /domains [allow|block|remove <домен>]
+func domainsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		allowed, blocked := chatDomainLists(chatID)
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatDomainLists(allowed, blocked)), true, 60)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	result, err := applyDomainCommand(chatSettings, args)
+	if err == nil {
+		writeChatSettings(ctx, chatID, chatSettings)
+	}
+	allowed, blocked := slices.Clone(chatSettings.AllowedDomains), slices.Clone(chatSettings.BlockedDomains)
+	settingsMux.Unlock()
+
+	if err != nil {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("%v\n\n%s", err, formatDomainLists(allowed, blocked))), true, 60)
+		return
+	}
+	zap.S().Infof("[domainsHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result+"\n\n"+formatDomainLists(allowed, blocked)), true, 60)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageURLs(t *testing.T) {
+	msg := &models.Message{
+		Text: "🔥 смотри spam.example/x и вот тут",
+		Entities: []models.MessageEntity{
+			// The emoji takes two UTF-16 code units.
+			{Type: models.MessageEntityTypeURL, Offset: 10, Length: 14},
+			{Type: models.MessageEntityTypeTextLink, Offset: 31, Length: 3, URL: "https://hidden.example/"},
+		},
+	}
+	assert.Equal(t, []string{"spam.example/x", "https://hidden.example/"}, messageURLs(msg))
+
+	captioned := &models.Message{
+		Caption:         "фото bit.ly/abc",
+		CaptionEntities: []models.MessageEntity{{Type: models.MessageEntityTypeURL, Offset: 5, Length: 10}},
+	}
+	assert.Equal(t, []string{"bit.ly/abc"}, messageURLs(captioned))
+
+	withButtons := &models.Message{
+		Text: "жми",
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "канал", URL: "https://t.me/+abc"}, {Text: "ок", CallbackData: "ok"}},
+		}},
+	}
+	assert.Equal(t, []string{"https://t.me/+abc"}, messageURLs(withButtons))
+}
+
+func TestUrlHost(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://Example.COM/path?q=1", "example.com"},
+		{"example.com/path", "example.com"},
+		{"http://user@sub.example.com:8080/", "sub.example.com"},
+		{"example.com.", "example.com"},
+		{"пример.рф", "пример.рф"},
+		{"", ""},
+		{"https://", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			assert.Equal(t, tt.want, urlHost(tt.raw))
+		})
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"example.com", "example.com", true},
+		{"https://www.Example.com/page", "example.com", true},
+		{"*.example.com", "example.com", true},
+		{"localhost", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := normalizeDomain(tt.in)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindBlockedLink(t *testing.T) {
+	blocked := []string{"example.com", "bit.ly"}
+	allowed := []string{"docs.example.com"}
+	tests := []struct {
+		name       string
+		urls       []string
+		wantHost   string
+		wantDomain string
+	}{
+		{name: "no links"},
+		{name: "unlisted domain", urls: []string{"https://golang.org"}},
+		{name: "blocked domain", urls: []string{"https://bit.ly/x"}, wantHost: "bit.ly", wantDomain: "bit.ly"},
+		{name: "blocked subdomain", urls: []string{"www.example.com/a"}, wantHost: "www.example.com", wantDomain: "example.com"},
+		{name: "suffix is not a subdomain", urls: []string{"https://notexample.com"}},
+		{name: "allowed subdomain wins", urls: []string{"https://docs.example.com/guide"}},
+		{name: "first blocked link reported", urls: []string{"docs.example.com", "https://spam.example.com", "bit.ly"},
+			wantHost: "spam.example.com", wantDomain: "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, domain := findBlockedLink(tt.urls, allowed, blocked)
+			assert.Equal(t, tt.wantHost, host)
+			assert.Equal(t, tt.wantDomain, domain)
+		})
+	}
+}
+
+func TestApplyDomainCommand(t *testing.T) {
+	cs := &DynamicSetting{}
+
+	_, err := applyDomainCommand(cs, []string{"block", "https://www.spam.example/x"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spam.example"}, cs.BlockedDomains)
+
+	_, err = applyDomainCommand(cs, []string{"block", "spam.example"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spam.example"}, cs.BlockedDomains, "no duplicates")
+
+	_, err = applyDomainCommand(cs, []string{"ALLOW", "spam.example"})
+	assert.NoError(t, err)
+	assert.Empty(t, cs.BlockedDomains, "allowing moves the domain off the blocklist")
+	assert.Equal(t, []string{"spam.example"}, cs.AllowedDomains)
+
+	_, err = applyDomainCommand(cs, []string{"remove", "spam.example"})
+	assert.NoError(t, err)
+	assert.Empty(t, cs.AllowedDomains)
+
+	_, err = applyDomainCommand(cs, []string{"remove", "spam.example"})
+	assert.Error(t, err)
+	_, err = applyDomainCommand(cs, []string{"block", "localhost"})
+	assert.Error(t, err)
+	_, err = applyDomainCommand(cs, []string{"ban", "spam.example"})
+	assert.Error(t, err)
+	_, err = applyDomainCommand(cs, []string{"block"})
+	assert.Error(t, err)
+}
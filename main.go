@@ -108,6 +108,11 @@ func main() {
 
 	initDb(ctx, mongoAddr, dbName)
 	settings = readChatsSettings(ctx)
+	patternLists = readPatternLists(ctx)
+	seedChatMembers(ctx)
+	seedActivity(ctx)
+	loadSpamModel(ctx)
+	loadActiveRaids(ctx)
 
 	client = &mtproto.MTProtoHelper{AppId: int(appId), AppHash: appHash, BotApiKey: botApiKey, Logger: logger}
 	if err = client.Init(ctx); err != nil {
@@ -128,11 +133,17 @@ func main() {
 		zap.S().Infof("[main] updated access hash for chatID=%d %q", chatSettings.ChatID, chatSettings.ChatName)
 	}
 
+	detector = detectorPoolFromEnv()
+
 	opts := []bot.Option{
 		bot.WithDefaultHandler(handler),
-		bot.WithMiddlewares(logMessagesMiddleware, detectorMiddleware),
+		// Updates are dispatched in order from one worker; detectorMiddleware
+		// queues them for the detector and hands them on to goroutines.
+		bot.WithWorkers(1),
+		bot.WithNotAsyncHandlers(),
+		bot.WithMiddlewares(detectorMiddleware, logMessagesMiddleware),
 		bot.WithCallbackQueryDataHandler("button", bot.MatchTypePrefix, voteCallbackHandler),
-		bot.WithAllowedUpdates(bot.AllowedUpdates{"message", "edited_message", "callback_query", "my_chat_member", "message_reaction", "message_reaction_count"}),
+		bot.WithAllowedUpdates(bot.AllowedUpdates{"message", "edited_message", "callback_query", "my_chat_member", "chat_member", "chat_join_request", "message_reaction", "message_reaction_count"}),
 	}
 
 	myBot, err = bot.New(botApiKey, opts...)
@@ -157,12 +168,36 @@ func main() {
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/voteeblan", bot.MatchTypePrefix, muteHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/text_only", bot.MatchTypePrefix, textOnlyHandler)
 	myBot.RegisterHandler(bot.HandlerTypeCallbackQueryData, "b_", bot.MatchTypePrefix, actionCallbackHandler)
+	// Registered before /test, which would otherwise match it as a prefix.
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/test_pattern", bot.MatchTypePrefix, testPatternHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/test", bot.MatchTypePrefix, testHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, startHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/delete", bot.MatchTypePrefix, deleteMessageHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/set_channel", bot.MatchTypePrefix, setChannelHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/add_pattern", bot.MatchTypePrefix, addPatternHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/del_pattern", bot.MatchTypePrefix, delPatternHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/add_global_pattern", bot.MatchTypePrefix, addGlobalPatternHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/pattern_stats", bot.MatchTypePrefix, patternStatsHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/edit_links", bot.MatchTypePrefix, editLinksHandler)
+	// Registered before /rule, which would otherwise match it as a prefix.
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/rules", bot.MatchTypePrefix, rulesHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/rule", bot.MatchTypePrefix, ruleHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/domains", bot.MatchTypePrefix, domainsHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/forwards", bot.MatchTypePrefix, forwardsHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/block_media", bot.MatchTypePrefix, blockMediaHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/unblock_media", bot.MatchTypePrefix, unblockMediaHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/name_check", bot.MatchTypePrefix, nameCheckHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/join_votes", bot.MatchTypePrefix, joinVotesHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/probation", bot.MatchTypePrefix, probationHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/raid", bot.MatchTypePrefix, raidHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/captcha", bot.MatchTypePrefix, captchaHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/retrain", bot.MatchTypePrefix, retrainHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/detector_stats", bot.MatchTypePrefix, detectorStatsHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/rating_decay", bot.MatchTypePrefix, ratingDecayHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/reaction_weights", bot.MatchTypePrefix, reactionWeightsHandler)
+	// Registered before /thanks, which would otherwise match it as a prefix.
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/thanks_words", bot.MatchTypePrefix, thanksWordsHandler)
+	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/thanks", bot.MatchTypePrefix, thanksHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/likes", bot.MatchTypePrefix, likesHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/best", bot.MatchTypePrefix, bestHandler)
 	myBot.RegisterHandler(bot.HandlerTypeMessageText, "/set_tag", bot.MatchTypePrefix, setTagHandler)
@@ -172,8 +207,21 @@ func main() {
 	go ticker(ctx, 43200, getChatAdmins)
 	// each 30 minutes expire votes older than 1.5 days
 	go ticker(ctx, 1800, expireOldVotes)
+	// each 10 minutes log detector pool counters
+	go ticker(ctx, 600, logDetectorStats)
+	// each 15 seconds kick newcomers who did not solve the captcha in time
+	go ticker(ctx, 15, expireCaptchas)
+	// each minute end raids nobody has joined for a while
+	go ticker(ctx, 60, expireRaids)
+	// each minute release members who have served their probation
+	go ticker(ctx, 60, releaseProbations)
 	// spam edit detector
-	reactionCache = cache.New[reactionKey, reactionEntry](ctx)
+	reactionWindows = cache.New[reactionKey, []reactionEvent](ctx)
+	reactionSpamReported = cache.New[reactionKey, struct{}](ctx)
+	publicChats = cache.New[string, bool](ctx)
+	mentionWindows = cache.New[reactionKey, []mentionEvent](ctx)
+	adminIdentities = cache.New[int64, []adminIdentity](ctx)
+	joinWindows = cache.New[int64, []joinEvent](ctx)
 	go startDetector(ctx, myBot)
 	myBot.Start(ctx)
 
@@ -185,5 +233,13 @@ func main() {
 }
 
 func handler(ctx context.Context, b *bot.Bot, update *models.Update) {
-
+	if update.ChatMember != nil {
+		processChatMember(ctx, b, update.ChatMember)
+	}
+	if update.ChatJoinRequest != nil {
+		processJoinRequest(ctx, b, update.ChatJoinRequest)
+	}
+	if update.Message != nil {
+		processThanksWord(ctx, b, update.Message)
+	}
 }
@@ -28,12 +28,35 @@ const (
 	ACTION_LEAVE_CHAT     uint8 = 10
 	ACTION_SHOW_VOTERS    uint8 = 11
 	ACTION_LIKES_PAGE     uint8 = 12
+	// shared pattern lists
+	ACTION_PATTERN_LISTS       uint8 = 13
+	ACTION_SHOW_PATTERN_LIST   uint8 = 14
+	ACTION_DEL_LIST_PATTERN    uint8 = 15
+	ACTION_DELETE_PATTERN_LIST uint8 = 16
+	ACTION_CHAT_PATTERN_LISTS  uint8 = 17
+	ACTION_TOGGLE_PATTERN_LIST uint8 = 18
+	ACTION_PATTERN_STATS       uint8 = 19
+	// detector reports
+	ACTION_DELETE_MESSAGE uint8 = 20
+	ACTION_BAN_USER       uint8 = 21
+	ACTION_START_VOTE     uint8 = 22
+	// join captcha
+	ACTION_CAPTCHA uint8 = 23
+	// raid panel
+	ACTION_END_RAID uint8 = 24
+	ACTION_BAN_RAID uint8 = 25
 )
 
 const (
 	DATA_TYPE_USERID uint8 = 1
 	DATA_TYPE_MSGID  uint8 = 2
 	DATA_TYPE_PAGE   uint8 = 3
+	DATA_TYPE_LIST   uint8 = 4
+	DATA_TYPE_INDEX  uint8 = 5
+	DATA_TYPE_RAID   uint8 = 6
+	DATA_TYPE_WINDOW uint8 = 7
+	DATA_TYPE_VIEW   uint8 = 8
+	DATA_TYPE_RULE   uint8 = 9
 )
 
 func getInt(data any) int64 {
@@ -85,6 +85,58 @@ func TestShowVotersButtonFitsCallbackData(t *testing.T) {
 	assert.Equal(t, int64(9999999999), getInt(decoded.Data[DATA_TYPE_MSGID]))
 }
 
+// TestPatternListButtonsFitCallbackData ensures the pattern list buttons, which
+// carry two data fields, stay within Telegram's 64-byte limit.
+func TestPatternListButtonsFitCallbackData(t *testing.T) {
+	kb := getPatternListKeyboard(PatternList{ID: 9999999, Name: "spam", Patterns: make([]string, 120)})
+	for _, row := range kb.InlineKeyboard {
+		for _, button := range row {
+			assert.LessOrEqual(t, len(button.CallbackData), 64, button.Text)
+		}
+	}
+
+	toggles := getChatPatternListsKeyboard(-1009999999999, []PatternList{{ID: 9999999, Name: "spam"}}, nil)
+	require.NotEmpty(t, toggles.InlineKeyboard)
+	button := toggles.InlineKeyboard[0][0]
+	assert.LessOrEqual(t, len(button.CallbackData), 64)
+
+	decoded, err := unmarshal(button.CallbackData[2:])
+	require.NoError(t, err)
+	assert.Equal(t, ACTION_TOGGLE_PATTERN_LIST, decoded.Action)
+	assert.Equal(t, int64(-1009999999999), decoded.ChatID)
+	assert.Equal(t, int64(9999999), getInt(decoded.Data[DATA_TYPE_LIST]))
+}
+
+// TestDetectorReportButtonsFitCallbackData ensures the detector report buttons,
+// whose ban button carries both a user and a message ID, stay within the
+// 64-byte limit.
+func TestDetectorReportButtonsFitCallbackData(t *testing.T) {
+	kb := getDetectorReportKeyboard(-1009999999999, 9999999999, 99999999, true)
+	require.Len(t, kb.InlineKeyboard, 1)
+	require.Len(t, kb.InlineKeyboard[0], 2)
+	for _, button := range kb.InlineKeyboard[0] {
+		assert.LessOrEqual(t, len(button.CallbackData), 64, button.Text)
+	}
+
+	decoded, err := unmarshal(kb.InlineKeyboard[0][1].CallbackData[2:])
+	require.NoError(t, err)
+	assert.Equal(t, ACTION_BAN_USER, decoded.Action)
+	assert.Equal(t, int64(9999999999), getInt(decoded.Data[DATA_TYPE_USERID]))
+	assert.Equal(t, int64(99999999), getInt(decoded.Data[DATA_TYPE_MSGID]))
+
+	assert.Len(t, getDetectorReportKeyboard(-1009999999999, 1, 1, false).InlineKeyboard[0], 1,
+		"a deleted message gets no delete button")
+
+	userKb := getUserReportKeyboard(-1009999999999, 9999999999, reactionSpamRule{}.Name())
+	for _, button := range userKb.InlineKeyboard[0] {
+		assert.LessOrEqual(t, len(button.CallbackData), 64, button.Text)
+	}
+	decoded, err = unmarshal(userKb.InlineKeyboard[0][0].CallbackData[2:])
+	require.NoError(t, err)
+	assert.Equal(t, ACTION_START_VOTE, decoded.Action)
+	assert.Equal(t, "reaction_spam", detectorRules[getInt(decoded.Data[DATA_TYPE_RULE])].Name())
+}
+
 func TestUnmarshalErrors(t *testing.T) {
 	t.Run("invalid base64", func(t *testing.T) {
 		_, err := unmarshal("!!!not-base64!!!")
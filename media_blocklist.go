@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// What a MediaFingerprint identifies.
+const (
+	MEDIA_STICKER_SET  uint8 = iota // a whole sticker set, by name
+	MEDIA_CUSTOM_EMOJI              // a custom emoji, by ID
+	MEDIA_FILE                      // one file, by file_unique_id
+)
+
+// MediaFingerprint identifies blocked media in DynamicSetting.BlockedMedia.
+type MediaFingerprint struct {
+	Kind  uint8
+	Value string
+}
+
+func (f MediaFingerprint) String() string {
+	switch f.Kind {
+	case MEDIA_STICKER_SET:
+		return "набор стикеров " + f.Value
+	case MEDIA_CUSTOM_EMOJI:
+		return "эмодзи " + f.Value
+	}
+	return "файл " + f.Value
+}
+
+// mediaRule deletes media on the chat's blocklist.
+type mediaRule struct{}
+
+func (mediaRule) Name() string {
+	return "media"
+}
+
+func (mediaRule) Description() string {
+	return "стикеры, эмодзи и файлы из списка /block_media"
+}
+
+func (mediaRule) DefaultAction() uint8 {
+	return RULE_ACTION_DELETE
+}
+
+func (mediaRule) Params() []RuleParam {
+	return nil
+}
+
+func (mediaRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil {
+		return nil
+	}
+	blocked := chatBlockedMedia(msg.Chat.ID)
+	if len(blocked) == 0 {
+		return nil
+	}
+	for _, f := range mediaFingerprints(msg) {
+		if slices.Contains(blocked, f) {
+			return messageVerdict(msg, buildStoredText(msg), fmt.Sprintf("заблокировано: %s", f))
+		}
+	}
+	return nil
+}
+
+// mediaFingerprints lists everything in a message a blocklist entry can
+// match: the sticker's set, custom emoji and file, custom emoji in the text and
+// caption, and the files of photos (every size), animations, videos and
+// documents.
+func mediaFingerprints(msg *models.Message) []MediaFingerprint {
+	var prints []MediaFingerprint
+	if s := msg.Sticker; s != nil {
+		if s.SetName != "" {
+			prints = append(prints, MediaFingerprint{MEDIA_STICKER_SET, s.SetName})
+		}
+		if s.CustomEmojiID != "" {
+			prints = append(prints, MediaFingerprint{MEDIA_CUSTOM_EMOJI, s.CustomEmojiID})
+		}
+		prints = append(prints, MediaFingerprint{MEDIA_FILE, s.FileUniqueID})
+	}
+	for _, entities := range [][]models.MessageEntity{msg.Entities, msg.CaptionEntities} {
+		for _, e := range entities {
+			if e.Type == models.MessageEntityTypeCustomEmoji && e.CustomEmojiID != "" {
+				prints = append(prints, MediaFingerprint{MEDIA_CUSTOM_EMOJI, e.CustomEmojiID})
+			}
+		}
+	}
+	for _, p := range msg.Photo {
+		prints = append(prints, MediaFingerprint{MEDIA_FILE, p.FileUniqueID})
+	}
+	if msg.Animation != nil {
+		prints = append(prints, MediaFingerprint{MEDIA_FILE, msg.Animation.FileUniqueID})
+	}
+	if msg.Video != nil {
+		prints = append(prints, MediaFingerprint{MEDIA_FILE, msg.Video.FileUniqueID})
+	}
+	if msg.Document != nil {
+		prints = append(prints, MediaFingerprint{MEDIA_FILE, msg.Document.FileUniqueID})
+	}
+	return prints
+}
+
+// mediaBlockTargets picks what /block_media blocks for a message: a sticker's
+// whole set (the file when it has none), its custom emoji, and otherwise the
+// same fingerprints mediaFingerprints matches, with only the largest photo
+// size, which every copy of the photo carries.
+func mediaBlockTargets(msg *models.Message) []MediaFingerprint {
+	var targets []MediaFingerprint
+	for _, f := range mediaFingerprints(msg) {
+		if msg.Sticker != nil && f.Kind == MEDIA_FILE && f.Value == msg.Sticker.FileUniqueID && msg.Sticker.SetName != "" {
+			continue
+		}
+		if len(msg.Photo) > 1 && f.Kind == MEDIA_FILE && slices.ContainsFunc(msg.Photo[:len(msg.Photo)-1],
+			func(p models.PhotoSize) bool { return p.FileUniqueID == f.Value }) {
+			continue
+		}
+		if !slices.Contains(targets, f) {
+			targets = append(targets, f)
+		}
+	}
+	return targets
+}
+
+// chatBlockedMedia returns a copy of the chat's media blocklist without
+// creating a settings record.
+func chatBlockedMedia(chatID int64) []MediaFingerprint {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		return slices.Clone(chatSettings.BlockedMedia)
+	}
+	return nil
+}
+
+// formatBlockedMedia lists the blocklist with 1-based numbers for removal.
+func formatBlockedMedia(blocked []MediaFingerprint) string {
+	lines := []string{"Заблокированные медиа:"}
+	if len(blocked) == 0 {
+		lines = append(lines, "пусто")
+	}
+	for i, f := range blocked {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, f))
+	}
+	lines = append(lines, "", "Заблокировать: ответьте /block_media на сообщение",
+		"Разблокировать: ответьте /unblock_media на сообщение или /unblock_media <номер>")
+	return strings.Join(lines, "\n")
+}
+
+// blockMediaHandler adds the media of the replied-to message to the chat's
+// blocklist and deletes that message. Without a reply it lists the blocklist.
+// Usage: /block_media (в ответ на сообщение)
+func blockMediaHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	target := update.Message.ReplyToMessage
+	if target == nil {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatBlockedMedia(chatBlockedMedia(chatID))), true, 60)
+		return
+	}
+	prints := mediaBlockTargets(target)
+	if len(prints) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape("В сообщении нет стикеров, эмодзи или файлов"), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	for _, f := range prints {
+		if !slices.Contains(chatSettings.BlockedMedia, f) {
+			chatSettings.BlockedMedia = append(chatSettings.BlockedMedia, f)
+		}
+	}
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	deleteMessagesConcurrently(ctx, b, chatID, []int64{int64(target.ID)}, "blockMediaHandler")
+	lines := []string{"Заблокировано:"}
+	for _, f := range prints {
+		lines = append(lines, f.String())
+	}
+	zap.S().Infof("[blockMediaHandler] chatID=%d blocked %v by userID=%d", chatID, prints, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(strings.Join(lines, "\n")), true, 30)
+}
+
+// unblockMediaHandler removes the media of the replied-to message, or the
+// blocklist entry with the given number, from the chat's blocklist.
+// Usage: /unblock_media [номер]
+func unblockMediaHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	var index int
+	if fields := strings.Fields(update.Message.Text); len(fields) == 2 {
+		index, _ = strconv.Atoi(fields[1])
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	var removed []MediaFingerprint
+	switch {
+	case update.Message.ReplyToMessage != nil:
+		prints := mediaFingerprints(update.Message.ReplyToMessage)
+		chatSettings.BlockedMedia = slices.DeleteFunc(chatSettings.BlockedMedia, func(f MediaFingerprint) bool {
+			if slices.Contains(prints, f) {
+				removed = append(removed, f)
+				return true
+			}
+			return false
+		})
+	case index >= 1 && index <= len(chatSettings.BlockedMedia):
+		removed = append(removed, chatSettings.BlockedMedia[index-1])
+		chatSettings.BlockedMedia = slices.Delete(chatSettings.BlockedMedia, index-1, index)
+	}
+	if len(removed) != 0 {
+		writeChatSettings(ctx, chatID, chatSettings)
+	}
+	blocked := slices.Clone(chatSettings.BlockedMedia)
+	settingsMux.Unlock()
+
+	if len(removed) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape("Нечего разблокировать\n\n"+formatBlockedMedia(blocked)), true, 60)
+		return
+	}
+	lines := []string{"Разблокировано:"}
+	for _, f := range removed {
+		lines = append(lines, f.String())
+	}
+	zap.S().Infof("[unblockMediaHandler] chatID=%d unblocked %v by userID=%d", chatID, removed, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(strings.Join(lines, "\n")), true, 30)
+}
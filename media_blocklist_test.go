@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaFingerprints(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *models.Message
+		want []MediaFingerprint
+	}{
+		{name: "plain text", msg: &models.Message{Text: "hi"}},
+		{
+			name: "sticker from a set",
+			msg:  &models.Message{Sticker: &models.Sticker{FileUniqueID: "st1", SetName: "spam_pack"}},
+			want: []MediaFingerprint{{MEDIA_STICKER_SET, "spam_pack"}, {MEDIA_FILE, "st1"}},
+		},
+		{
+			name: "custom emoji in text and caption",
+			msg: &models.Message{
+				Entities:        []models.MessageEntity{{Type: models.MessageEntityTypeCustomEmoji, CustomEmojiID: "e1"}},
+				CaptionEntities: []models.MessageEntity{{Type: models.MessageEntityTypeCustomEmoji, CustomEmojiID: "e2"}},
+			},
+			want: []MediaFingerprint{{MEDIA_CUSTOM_EMOJI, "e1"}, {MEDIA_CUSTOM_EMOJI, "e2"}},
+		},
+		{
+			name: "every photo size",
+			msg:  &models.Message{Photo: []models.PhotoSize{{FileUniqueID: "small"}, {FileUniqueID: "big"}}},
+			want: []MediaFingerprint{{MEDIA_FILE, "small"}, {MEDIA_FILE, "big"}},
+		},
+		{
+			name: "animation",
+			msg:  &models.Message{Animation: &models.Animation{FileUniqueID: "gif1"}},
+			want: []MediaFingerprint{{MEDIA_FILE, "gif1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mediaFingerprints(tt.msg))
+		})
+	}
+}
+
+func TestMediaBlockTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *models.Message
+		want []MediaFingerprint
+	}{
+		{
+			name: "sticker blocks its whole set",
+			msg:  &models.Message{Sticker: &models.Sticker{FileUniqueID: "st1", SetName: "spam_pack"}},
+			want: []MediaFingerprint{{MEDIA_STICKER_SET, "spam_pack"}},
+		},
+		{
+			name: "sticker without a set blocks the file",
+			msg:  &models.Message{Sticker: &models.Sticker{FileUniqueID: "st1"}},
+			want: []MediaFingerprint{{MEDIA_FILE, "st1"}},
+		},
+		{
+			name: "photo blocks the largest size",
+			msg:  &models.Message{Photo: []models.PhotoSize{{FileUniqueID: "small"}, {FileUniqueID: "big"}}},
+			want: []MediaFingerprint{{MEDIA_FILE, "big"}},
+		},
+		{
+			name: "repeated emoji blocked once",
+			msg: &models.Message{Entities: []models.MessageEntity{
+				{Type: models.MessageEntityTypeCustomEmoji, CustomEmojiID: "e1"},
+				{Type: models.MessageEntityTypeCustomEmoji, CustomEmojiID: "e1"},
+			}},
+			want: []MediaFingerprint{{MEDIA_CUSTOM_EMOJI, "e1"}},
+		},
+		{name: "nothing to block", msg: &models.Message{Text: "hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mediaBlockTargets(tt.msg))
+		})
+	}
+}
@@ -64,6 +64,7 @@ func textOnlyUser(ctx context.Context, b *bot.Bot, s *BanInfo) bool {
 		if err != nil {
 			zap.S().Infof("[textOnlyUser] userAddMuteCounter failed: userID=%d chatID=%d: %v", s.UserID, s.ChatID, err)
 		}
+		chatMemberAddMute(ctx, s.ChatID, s.UserID)
 	}
 
 	deleteMessagesConcurrently(ctx, b, s.ChatID, []int64{s.VoteMessageID, s.RequestMessageID}, "textOnlyUser")
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/ice2heart/poke_bot/cache"
+)
+
+// Defaults of the mentions rule parameters.
+const (
+	mentionsPerMessage = 5
+	mentionsPerWindow  = 10
+	mentionsWindowSec  = 300
+)
+
+// mentionEvent is one message's mentions in a user's sliding window.
+type mentionEvent struct {
+	messageID int
+	count     int
+	at        time.Time
+}
+
+var (
+	mentionsMux sync.Mutex
+	// mentionWindows holds each user's recent mentioning messages per chat.
+	mentionWindows *cache.Cache[reactionKey, []mentionEvent]
+)
+
+// mentionRule flags members pinging many people at once, in one message or
+// spread over several within a short window.
+type mentionRule struct{}
+
+func (mentionRule) Name() string {
+	return "mentions"
+}
+
+func (mentionRule) Description() string {
+	return "массовые упоминания участников"
+}
+
+func (mentionRule) DefaultAction() uint8 {
+	return RULE_ACTION_MUTE
+}
+
+func (mentionRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "per_message", Default: mentionsPerMessage, Description: "больше стольких упоминаний в одном сообщении"},
+		{Name: "per_window", Default: mentionsPerWindow, Description: "больше стольких упоминаний от одного автора за окно"},
+		{Name: "window", Default: mentionsWindowSec, Description: "окно в секундах"},
+	}
+}
+
+func (mentionRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil {
+		return nil
+	}
+	count := countMentions(msg)
+	if count == 0 {
+		return nil
+	}
+
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	v := messageVerdict(msg, text, "")
+	window := time.Duration(cfg.Params["window"]) * time.Second
+	key := reactionKey{chatID: msg.Chat.ID, userID: v.UserID}
+
+	mentionsMux.Lock()
+	defer mentionsMux.Unlock()
+	events, _ := mentionWindows.Get(key)
+	events = addMentionEvent(events, mentionEvent{messageID: msg.ID, count: count, at: time.Now()}, window)
+	total := 0
+	for _, e := range events {
+		total += e.count
+	}
+	switch {
+	case count > cfg.Params["per_message"]:
+		v.Evidence = fmt.Sprintf("%d упоминаний в сообщении", count)
+	case total > cfg.Params["per_window"]:
+		v.Evidence = fmt.Sprintf("%d упоминаний за %d с", total, cfg.Params["window"])
+	default:
+		mentionWindows.Set(key, events, window)
+		return nil
+	}
+	// Start the next window afresh: the messages counted so far are dealt with.
+	mentionWindows.Delete(key)
+	return v
+}
+
+// countMentions counts @username mentions and mentions of users without a
+// username in a message's text and caption.
+func countMentions(msg *models.Message) int {
+	count := 0
+	for _, entities := range [][]models.MessageEntity{msg.Entities, msg.CaptionEntities} {
+		for _, e := range entities {
+			if e.Type == models.MessageEntityTypeMention || e.Type == models.MessageEntityTypeTextMention {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// addMentionEvent appends ev to the window, dropping events older than the
+// window. An edit replaces the count of the message it edits.
+func addMentionEvent(events []mentionEvent, ev mentionEvent, window time.Duration) []mentionEvent {
+	since := ev.at.Add(-window)
+	kept := make([]mentionEvent, 0, len(events)+1)
+	for _, e := range events {
+		if e.at.Before(since) || e.messageID == ev.messageID {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return append(kept, ev)
+}
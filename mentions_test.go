@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountMentions(t *testing.T) {
+	msg := &models.Message{
+		Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeMention},
+			{Type: models.MessageEntityTypeTextMention, User: &models.User{ID: 1}},
+			{Type: models.MessageEntityTypeURL},
+		},
+		CaptionEntities: []models.MessageEntity{{Type: models.MessageEntityTypeMention}},
+	}
+	assert.Equal(t, 3, countMentions(msg))
+	assert.Equal(t, 0, countMentions(&models.Message{Text: "hi"}))
+}
+
+func TestAddMentionEvent(t *testing.T) {
+	now := time.Now()
+	events := []mentionEvent{
+		{messageID: 1, count: 4, at: now.Add(-10 * time.Minute)},
+		{messageID: 2, count: 3, at: now.Add(-time.Minute)},
+		{messageID: 3, count: 2, at: now.Add(-30 * time.Second)},
+	}
+	got := addMentionEvent(events, mentionEvent{messageID: 3, count: 5, at: now}, 5*time.Minute)
+	assert.Equal(t, []mentionEvent{
+		{messageID: 2, count: 3, at: now.Add(-time.Minute)},
+		{messageID: 3, count: 5, at: now},
+	}, got, "old events expire and an edit replaces its message's count")
+}
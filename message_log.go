@@ -61,13 +61,17 @@ func logMessagesMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 			// once the handler returns, which would abort these background writes.
 			bgCtx := context.WithoutCancel(ctx)
 			go userPlusOneMessage(bgCtx, userID, userName, altUserName)
+			go chatMemberPlusOneMessage(bgCtx, update.Message.Chat.ID, userID, update.Message.ID)
+			storedText := buildStoredText(update.Message)
 			go saveMessage(bgCtx, &ChatMessage{
-				MessageID: int64(update.Message.ID),
-				ChatID:    update.Message.Chat.ID,
-				UserID:    userID,
-				UserName:  userName,
-				Text:      buildStoredText(update.Message),
-				Date:      uint64(now.AddDate(0, 0, MESSAGE_TTL_DAYS).UnixMilli()),
+				MessageID:      int64(update.Message.ID),
+				ChatID:         update.Message.Chat.ID,
+				UserID:         userID,
+				UserName:       userName,
+				Text:           storedText,
+				NormalizedText: normalizeText(storedText),
+				Date:           uint64(now.AddDate(0, 0, MESSAGE_TTL_DAYS).UnixMilli()),
+				ForwardOrigin:  forwardOriginOf(update.Message),
 			})
 		}
 		if update.EditedMessage != nil {
@@ -81,9 +85,10 @@ func logMessagesMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 				storedText = fmt.Sprintf("%s\n%s", storedText, strings.Join(hiddenUrls, "\n"))
 			}
 			go updateMessage(context.WithoutCancel(ctx), &ChatMessage{
-				MessageID: int64(update.EditedMessage.ID),
-				ChatID:    update.EditedMessage.Chat.ID,
-				Text:      storedText,
+				MessageID:      int64(update.EditedMessage.ID),
+				ChatID:         update.EditedMessage.Chat.ID,
+				Text:           storedText,
+				NormalizedText: normalizeText(storedText),
 			})
 
 		}
@@ -93,8 +98,10 @@ func logMessagesMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 }
 
 // buildStoredText derives the text to store for a message: media messages get
-// a description instead, hidden text-link URLs are appended, and captionless
-// photos/videos fall back to a placeholder.
+// a description instead, hidden text-link URLs are appended and captionless
+// photos/videos fall back to a placeholder. It is what ban patterns and the
+// classifier see, so a forward's origin is kept apart in ForwardOrigin and
+// only shown with withForwardOrigin.
 func buildStoredText(msg *models.Message) string {
 	storedText := msg.Text
 	if msg.Sticker != nil {
@@ -122,6 +129,49 @@ func buildStoredText(msg *models.Message) string {
 	return storedText
 }
 
+// withForwardOrigin names the origin of a forwarded message before its text
+// for display; text is returned as is when origin is nil.
+func withForwardOrigin(origin *ForwardOrigin, text string) string {
+	if origin == nil {
+		return text
+	}
+	return fmt.Sprintf("Forwarded from %s:\n%s", origin.Name, text)
+}
+
+// forwardOriginOf describes where msg was forwarded from, nil when it is not
+// a forward.
+func forwardOriginOf(msg *models.Message) *ForwardOrigin {
+	if msg.ForwardOrigin == nil {
+		return nil
+	}
+	chatName := func(chat models.Chat) string {
+		if chat.Username != "" {
+			return "@" + chat.Username
+		}
+		return chat.Title
+	}
+	origin := &ForwardOrigin{Type: string(msg.ForwardOrigin.Type)}
+	switch o := msg.ForwardOrigin; o.Type {
+	case models.MessageOriginTypeUser:
+		origin.UserID = o.MessageOriginUser.SenderUser.ID
+		origin.Name = strings.TrimSpace(o.MessageOriginUser.SenderUser.FirstName + " " + o.MessageOriginUser.SenderUser.LastName)
+		if o.MessageOriginUser.SenderUser.Username != "" {
+			origin.Name = "@" + o.MessageOriginUser.SenderUser.Username
+		}
+	case models.MessageOriginTypeHiddenUser:
+		origin.Name = o.MessageOriginHiddenUser.SenderUserName
+	case models.MessageOriginTypeChat:
+		origin.ChatID = o.MessageOriginChat.SenderChat.ID
+		origin.Name = chatName(o.MessageOriginChat.SenderChat)
+	case models.MessageOriginTypeChannel:
+		origin.ChatID = o.MessageOriginChannel.Chat.ID
+		origin.Name = chatName(o.MessageOriginChannel.Chat)
+	default:
+		return nil
+	}
+	return origin
+}
+
 // collectHiddenURLs returns all explicit URL values (text-link entities) from
 // the provided entity slices. Plain URL entities are not included as their URL
 // is already visible in the message text.
@@ -66,6 +66,17 @@ func TestBuildStoredText(t *testing.T) {
 			msg:  &models.Message{Video: &models.Video{FileID: "v"}},
 			want: "A video without text",
 		},
+		{
+			name: "forward origin is left out",
+			msg: &models.Message{
+				Text: "promo",
+				ForwardOrigin: &models.MessageOrigin{
+					Type:                 models.MessageOriginTypeChannel,
+					MessageOriginChannel: &models.MessageOriginChannel{Chat: models.Chat{ID: -100123, Username: "spamchan"}},
+				},
+			},
+			want: "promo",
+		},
 		{
 			name: "empty message",
 			msg:  &models.Message{},
@@ -206,3 +217,55 @@ func TestExtractLinkedMessageIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestForwardOriginOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin *models.MessageOrigin
+		want   *ForwardOrigin
+	}{
+		{name: "not a forward"},
+		{
+			name: "user with username",
+			origin: &models.MessageOrigin{Type: models.MessageOriginTypeUser,
+				MessageOriginUser: &models.MessageOriginUser{SenderUser: models.User{ID: 42, FirstName: "Ann", Username: "ann"}}},
+			want: &ForwardOrigin{Type: "user", UserID: 42, Name: "@ann"},
+		},
+		{
+			name: "user without username",
+			origin: &models.MessageOrigin{Type: models.MessageOriginTypeUser,
+				MessageOriginUser: &models.MessageOriginUser{SenderUser: models.User{ID: 42, FirstName: "Ann", LastName: "Lee"}}},
+			want: &ForwardOrigin{Type: "user", UserID: 42, Name: "Ann Lee"},
+		},
+		{
+			name: "hidden user",
+			origin: &models.MessageOrigin{Type: models.MessageOriginTypeHiddenUser,
+				MessageOriginHiddenUser: &models.MessageOriginHiddenUser{SenderUserName: "Someone"}},
+			want: &ForwardOrigin{Type: "hidden_user", Name: "Someone"},
+		},
+		{
+			name: "anonymous group admin",
+			origin: &models.MessageOrigin{Type: models.MessageOriginTypeChat,
+				MessageOriginChat: &models.MessageOriginChat{SenderChat: models.Chat{ID: -1005, Title: "Group"}}},
+			want: &ForwardOrigin{Type: "chat", ChatID: -1005, Name: "Group"},
+		},
+		{
+			name: "channel",
+			origin: &models.MessageOrigin{Type: models.MessageOriginTypeChannel,
+				MessageOriginChannel: &models.MessageOriginChannel{Chat: models.Chat{ID: -100123, Title: "Spam", Username: "spamchan"}}},
+			want: &ForwardOrigin{Type: "channel", ChatID: -100123, Name: "@spamchan"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, forwardOriginOf(&models.Message{ForwardOrigin: tt.origin}))
+		})
+	}
+}
+
+func TestWithForwardOrigin(t *testing.T) {
+	assert.Equal(t, "promo", withForwardOrigin(nil, "promo"))
+	assert.Equal(t, "Forwarded from @spamchan:\npromo", withForwardOrigin(&ForwardOrigin{Type: "channel", Name: "@spamchan"}, "promo"))
+	m := &ChatMessage{Text: "promo", ForwardOrigin: &ForwardOrigin{Name: "@spamchan"}}
+	assert.Equal(t, "Forwarded from @spamchan:\npromo", m.displayText())
+}
@@ -65,6 +65,7 @@ func muteUser(ctx context.Context, b *bot.Bot, s *BanInfo) bool {
 		if err != nil {
 			zap.S().Infof("[muteUser] userAddMuteCounter failed: userID=%d chatID=%d: %v", s.UserID, s.ChatID, err)
 		}
+		chatMemberAddMute(ctx, s.ChatID, s.UserID)
 	}
 
 	deleteMessagesConcurrently(ctx, b, s.ChatID, []int64{s.VoteMessageID, s.RequestMessageID}, "muteUser")
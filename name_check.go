@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/ice2heart/poke_bot/cache"
+	"go.uber.org/zap"
+)
+
+// What the name check does with a newcomer whose name looks suspicious, as
+// stored in DynamicSetting.NameCheck.
+const (
+	NAME_CHECK_OFF      uint8 = iota // no name check
+	NAME_CHECK_REPORT                // report to the log recipients
+	NAME_CHECK_RESTRICT              // restrict until an admin lifts it, and report
+)
+
+// nameCheckModes are the /name_check modes by argument.
+var nameCheckModes = map[string]uint8{
+	"off":      NAME_CHECK_OFF,
+	"report":   NAME_CHECK_REPORT,
+	"restrict": NAME_CHECK_RESTRICT,
+}
+
+// nameLinkRegex finds links and bare domains in names: "t.me/...", "www.x",
+// "crypto-bonus.xyz".
+var nameLinkRegex = regexp.MustCompile(`(?i)https?://|t\.me/|www\.|[\p{L}\d-]+\s?\.\s?(com|net|org|ru|io|me|xyz|top|site|online|club|shop|info|biz|pro|app|link|vip|cc|bet|casino)\b`)
+
+// impersonationMinLen is the length below which an admin's name has to match a
+// newcomer's exactly: a short name is too likely to occur inside another one.
+const impersonationMinLen = 5
+
+// adminIdentity is what an admin is recognised by: the display name and the
+// username.
+type adminIdentity struct {
+	userID   int64
+	name     string
+	username string
+}
+
+// adminIdentities caches the identities of each chat's admins, which are only
+// known by ID in the admins map.
+var adminIdentities *cache.Cache[int64, []adminIdentity]
+
+// adminIdentitiesTTL matches the refresh period of the admins map.
+const adminIdentitiesTTL = 12 * time.Hour
+
+// chatNameCheck returns the chat's name check mode and a copy of its name
+// patterns, without creating a settings record.
+func chatNameCheck(chatID int64) (mode uint8, patterns []string) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		return chatSettings.NameCheck, slices.Clone(chatSettings.NamePatterns)
+	}
+	return NAME_CHECK_OFF, nil
+}
+
+// nameKey reduces a name to what it looks like: normalized, lower-cased, and
+// only letters and digits, so "Ivan_Petrov", "ivan petrov" and "Іvаn Pеtrоv"
+// compare equal.
+func nameKey(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(normalizeText(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// impersonatedAdmin returns the admin whose name or username the newcomer's
+// name or username copies, or contains when it is long enough.
+func impersonatedAdmin(userID int64, name, username string, admins []adminIdentity) (adminIdentity, bool) {
+	keys := []string{nameKey(name), nameKey(username)}
+	for _, admin := range admins {
+		if admin.userID == userID {
+			continue
+		}
+		for _, adminKey := range []string{nameKey(admin.name), nameKey(admin.username)} {
+			if adminKey == "" {
+				continue
+			}
+			for _, key := range keys {
+				if key == adminKey || (len([]rune(adminKey)) >= impersonationMinLen && strings.Contains(key, adminKey)) {
+					return admin, true
+				}
+			}
+		}
+	}
+	return adminIdentity{}, false
+}
+
+// nameFindings lists what is suspicious about a newcomer's name and username:
+// a link, a match with one of the chat's name patterns, a copied admin name.
+func nameFindings(userID int64, name, username string, patterns []string, admins []adminIdentity) []string {
+	var found []string
+	if nameLinkRegex.MatchString(name) {
+		found = append(found, "ссылка в имени")
+	}
+	for _, text := range []string{name, username} {
+		if matched := matchBanPattern(patterns, text); matched != "" {
+			found = append(found, fmt.Sprintf("совпадение с шаблоном %s", matched))
+			break
+		}
+	}
+	if admin, ok := impersonatedAdmin(userID, name, username, admins); ok {
+		label := admin.name
+		if admin.username != "" {
+			label = "@" + admin.username
+		}
+		found = append(found, fmt.Sprintf("похоже на администратора %s", label))
+	}
+	return found
+}
+
+// chatAdminIdentities resolves the admins in the admins map to their names,
+// from the user records or, for admins who never wrote, from Telegram.
+func chatAdminIdentities(ctx context.Context, b *bot.Bot, chatID int64) []adminIdentity {
+	if identities, ok := adminIdentities.Get(chatID); ok {
+		return identities
+	}
+	adminsMux.Lock()
+	ids := slices.Collect(maps.Keys(checkAdmins(ctx, b, chatID)))
+	adminsMux.Unlock()
+
+	identities := make([]adminIdentity, 0, len(ids))
+	for _, id := range ids {
+		if user, err := getUser(ctx, id); err == nil {
+			identities = append(identities, adminIdentity{userID: id, name: user.AltUsername, username: user.Username})
+			continue
+		}
+		member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chatID, UserID: id})
+		if err != nil {
+			zap.S().Infof("[chatAdminIdentities] GetChatMember failed for chatID=%d userID=%d: %v", chatID, id, err)
+			continue
+		}
+		var user *models.User
+		switch {
+		case member.Owner != nil:
+			user = member.Owner.User
+		case member.Administrator != nil:
+			user = &member.Administrator.User
+		}
+		if user != nil {
+			identities = append(identities, adminIdentity{userID: id, name: user.FirstName + " " + user.LastName, username: user.Username})
+		}
+	}
+	adminIdentities.Set(chatID, identities, adminIdentitiesTTL)
+	return identities
+}
+
+// screenJoinName checks a newcomer's name and reports, or restricts and
+// reports, a suspicious one. It reports whether the newcomer was restricted.
+func screenJoinName(ctx context.Context, b *bot.Bot, chatID int64, user *models.User) bool {
+	mode, patterns := chatNameCheck(chatID)
+	if mode == NAME_CHECK_OFF {
+		return false
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	found := nameFindings(user.ID, name, user.Username, patterns, chatAdminIdentities(ctx, b, chatID))
+	if len(found) == 0 {
+		return false
+	}
+	zap.S().Infof("[screenJoinName] chatID=%d userID=%d name=%q username=%q: %v", chatID, user.ID, name, user.Username, found)
+
+	restricted := mode == NAME_CHECK_RESTRICT && restrictNewcomer(ctx, b, chatID, user.ID)
+	report := fmt.Sprintf("%s\nПодозрительное имя у нового участника %s\n%s",
+		escape(getChatNameFromSettings(chatID)), userTag(user.Username, name, user.ID), escape(strings.Join(found, ", ")))
+	if restricted {
+		report += "\n\n" + escape("Участник ограничен до решения администратора")
+	}
+	sendReportToRecipients(ctx, b, chatID, report, getNameCheckKeyboard(chatID, user.ID, restricted), "screenJoinName")
+	return restricted
+}
+
+// formatNameCheck describes the chat's name check in plain text.
+func formatNameCheck(mode uint8, patterns []string) string {
+	modes := map[uint8]string{
+		NAME_CHECK_OFF:      "выключена",
+		NAME_CHECK_REPORT:   "сообщать администраторам",
+		NAME_CHECK_RESTRICT: "ограничивать и сообщать администраторам",
+	}
+	lines := []string{
+		fmt.Sprintf("Проверка имён новых участников: %s", modes[mode]),
+		"Проверяются ссылки в имени, сходство с именами администраторов и шаблоны:",
+	}
+	if len(patterns) == 0 {
+		lines = append(lines, "нет")
+	}
+	for i, p := range patterns {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, p))
+	}
+	lines = append(lines, "", "Режим: /name_check report|restrict|off",
+		"Шаблоны: /name_check add <регулярное выражение>, /name_check remove <номер>")
+	return strings.Join(lines, "\n")
+}
+
+// textAfterArg returns the trimmed text after the command and its first
+// argument arg, however they are separated: spaces, tabs or new lines.
+func textAfterArg(text, arg string) string {
+	rest := text[len(strings.Fields(text)[0]):]
+	return strings.TrimSpace(rest[strings.Index(rest, arg)+len(arg):])
+}
+
+// nameCheckHandler shows or configures the check of newcomers' names.
+// Usage: /name_check [report|restrict|off | add <regex> | remove <номер>]
+func nameCheckHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatNameCheck(chatNameCheck(chatID))), true, 60)
+		return
+	}
+
+	var result string
+	switch command := strings.ToLower(args[0]); command {
+	case "add":
+		// The pattern is the rest of the text and may contain spaces.
+		pattern := textAfterArg(update.Message.Text, args[0])
+		if pattern == "" {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape("Использование: /name_check add <регулярное выражение>"), true, 30)
+			return
+		}
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Некорректное регулярное выражение: %v", err)), true, 30)
+			return
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		if !slices.Contains(chatSettings.NamePatterns, pattern) {
+			chatSettings.NamePatterns = append(chatSettings.NamePatterns, pattern)
+			writeChatSettings(ctx, chatID, chatSettings)
+		}
+		settingsMux.Unlock()
+		result = fmt.Sprintf("Шаблон имени добавлен: %s", pattern)
+	case "remove":
+		index := 0
+		if len(args) == 2 {
+			index, _ = strconv.Atoi(args[1])
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		removed := ""
+		if index >= 1 && index <= len(chatSettings.NamePatterns) {
+			removed = chatSettings.NamePatterns[index-1]
+			chatSettings.NamePatterns = slices.Delete(chatSettings.NamePatterns, index-1, index)
+			writeChatSettings(ctx, chatID, chatSettings)
+		}
+		settingsMux.Unlock()
+		if removed == "" {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape("Неверный номер\n\n"+formatNameCheck(chatNameCheck(chatID))), true, 60)
+			return
+		}
+		result = fmt.Sprintf("Шаблон имени удалён: %s", removed)
+	default:
+		mode, ok := nameCheckModes[command]
+		if !ok || len(args) != 1 {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatNameCheck(chatNameCheck(chatID))), true, 60)
+			return
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		chatSettings.NameCheck = mode
+		writeChatSettings(ctx, chatID, chatSettings)
+		settingsMux.Unlock()
+		result = formatNameCheck(chatNameCheck(chatID))
+		if mode != NAME_CHECK_OFF {
+			result += "\n\nБоту нужны права администратора, чтобы видеть вступления"
+		}
+	}
+	zap.S().Infof("[nameCheckHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
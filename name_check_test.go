@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameKey(t *testing.T) {
+	assert.Equal(t, nameKey("Ivan Petrov"), nameKey("ivan_petrov"))
+	assert.Equal(t, nameKey("Ivan Petrov"), nameKey("Іvаn Pеtrоv"))
+	assert.Equal(t, "", nameKey("  _ "))
+}
+
+func TestNameFindings(t *testing.T) {
+	admins := []adminIdentity{
+		{userID: 1, name: "Ivan Petrov", username: "ivan_admin"},
+		{userID: 2, name: "Ed", username: ""},
+	}
+	patterns := []string{`casino|крипт`}
+	tests := []struct {
+		name     string
+		userID   int64
+		fullName string
+		username string
+		want     []string
+	}{
+		{name: "ordinary", userID: 10, fullName: "Maria Ivanova", username: "maria"},
+		{name: "link", userID: 10, fullName: "Free money t.me/bonus", want: []string{"ссылка в имени"}},
+		{name: "bare domain", userID: 10, fullName: "best-casino.xyz", want: []string{"ссылка в имени", "совпадение с шаблоном casino|крипт"}},
+		{name: "username pattern", userID: 10, fullName: "Anna", username: "krypto_casino", want: []string{"совпадение с шаблоном casino|крипт"}},
+		{name: "admin name", userID: 10, fullName: "Ivan Petrov", want: []string{"похоже на администратора @ivan_admin"}},
+		{name: "admin name with homoglyphs", userID: 10, fullName: "Іvаn Pеtrоv", want: []string{"похоже на администратора @ivan_admin"}},
+		{name: "admin username inside", userID: 10, fullName: "Support", username: "ivan_admin_help", want: []string{"похоже на администратора @ivan_admin"}},
+		{name: "short admin name only exact", userID: 10, fullName: "Eddie"},
+		{name: "short admin name exact", userID: 10, fullName: "Ed", want: []string{"похоже на администратора Ed"}},
+		{name: "the admin themselves", userID: 1, fullName: "Ivan Petrov", username: "ivan_admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nameFindings(tt.userID, tt.fullName, tt.username, patterns, admins))
+		})
+	}
+}
+
+func TestTextAfterArg(t *testing.T) {
+	assert.Equal(t, "x y", textAfterArg("/name_check add x y", "add"))
+	assert.Equal(t, "x", textAfterArg("/name_check\nadd x", "add"))
+	assert.Equal(t, "x", textAfterArg("/name_check\tadd\tx", "add"))
+	assert.Equal(t, "^add", textAfterArg("/name_check add ^add", "add"))
+	assert.Equal(t, "", textAfterArg("/name_check add", "add"))
+}
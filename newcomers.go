@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// newcomerMessages is the default number of a member's first messages in a
+// chat the newcomer rule checks.
+const newcomerMessages = 3
+
+// newcomerChecks are what the newcomer rule looks for, by the name of the
+// parameter switching each check on (1) or off (0), with its name in verdicts.
+var newcomerChecks = []struct {
+	param string
+	label string
+}{
+	{"links", "ссылка"},
+	{"media", "медиа"},
+	{"forwards", "пересылка"},
+	{"mentions", "упоминание"},
+}
+
+// newcomerRule is stricter with the first messages of a member in a chat:
+// links, media, forwards and mentions there are typical of spam accounts.
+type newcomerRule struct{}
+
+func (newcomerRule) Name() string {
+	return "newcomer"
+}
+
+func (newcomerRule) Description() string {
+	return "ссылки, медиа, пересылки и упоминания в первых сообщениях участника"
+}
+
+func (newcomerRule) DefaultAction() uint8 {
+	return RULE_ACTION_REPORT
+}
+
+func (newcomerRule) Params() []RuleParam {
+	params := []RuleParam{
+		{Name: "messages", Default: newcomerMessages, Description: "сколько первых сообщений участника проверять"},
+	}
+	for _, c := range newcomerChecks {
+		params = append(params, RuleParam{Name: c.param, Default: 1, Description: fmt.Sprintf("1 — проверять: %s, 0 — нет", c.label)})
+	}
+	return params
+}
+
+func (newcomerRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil || msg.IsAutomaticForward || isLinkedChannelPost(msg) {
+		return nil
+	}
+	found := newcomerFindings(msg, cfg.Params)
+	if len(found) == 0 {
+		return nil
+	}
+
+	v := messageVerdict(msg, buildStoredText(msg), "")
+	// An unknown member has no messages at all.
+	before := 0
+	if member, err := getChatMember(ctx, msg.Chat.ID, v.UserID); err == nil {
+		before = messagesBefore(member, msg.ID)
+	}
+	if before >= cfg.Params["messages"] {
+		return nil
+	}
+	v.Evidence = fmt.Sprintf("новый участник, сообщений в чате до этого: %d; %s", before, strings.Join(found, ", "))
+	return v
+}
+
+// messagesBefore is how many of the member's messages in the chat came before
+// the given one. The message log counts messages in the background, so the
+// message itself may or may not be counted yet.
+func messagesBefore(member *ChatMember, messageID int) int {
+	if member.LastMessageID >= messageID {
+		return max(member.Messages-1, 0)
+	}
+	return member.Messages
+}
+
+// newcomerFindings lists the enabled checks a message trips.
+func newcomerFindings(msg *models.Message, params map[string]int) []string {
+	hits := map[string]bool{
+		"links":    len(messageURLs(msg)) != 0,
+		"media":    len(msg.Photo) != 0 || msg.Video != nil || msg.Animation != nil || msg.Document != nil || msg.Audio != nil || msg.Voice != nil || msg.VideoNote != nil,
+		"forwards": msg.ForwardOrigin != nil,
+		"mentions": countMentions(msg) != 0,
+	}
+	var found []string
+	for _, c := range newcomerChecks {
+		if hits[c.param] && params[c.param] != 0 {
+			found = append(found, c.label)
+		}
+	}
+	return found
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewcomerFindings(t *testing.T) {
+	all := resolveRuleConfig(newcomerRule{}, nil).Params
+	tests := []struct {
+		name   string
+		msg    *models.Message
+		params map[string]int
+		want   []string
+	}{
+		{name: "plain text", msg: &models.Message{Text: "привет всем"}, params: all},
+		{
+			name:   "link",
+			msg:    &models.Message{Text: "go", Entities: []models.MessageEntity{{Type: models.MessageEntityTypeTextLink, URL: "https://spam.example"}}},
+			params: all,
+			want:   []string{"ссылка"},
+		},
+		{
+			name:   "forwarded photo",
+			msg:    &models.Message{Photo: []models.PhotoSize{{FileID: "p"}}, ForwardOrigin: &models.MessageOrigin{Type: models.MessageOriginTypeHiddenUser}},
+			params: all,
+			want:   []string{"медиа", "пересылка"},
+		},
+		{
+			name:   "mention",
+			msg:    &models.Message{Text: "@someone", Entities: []models.MessageEntity{{Type: models.MessageEntityTypeMention, Length: 8}}},
+			params: all,
+			want:   []string{"упоминание"},
+		},
+		{
+			name:   "disabled check",
+			msg:    &models.Message{Photo: []models.PhotoSize{{FileID: "p"}}},
+			params: map[string]int{"links": 1, "media": 0, "forwards": 1, "mentions": 1},
+		},
+		{
+			name:   "stickers are not media here",
+			msg:    &models.Message{Sticker: &models.Sticker{FileID: "s"}},
+			params: all,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newcomerFindings(tt.msg, tt.params))
+		})
+	}
+}
+
+func TestMessagesBefore(t *testing.T) {
+	assert.Equal(t, 0, messagesBefore(&ChatMember{}, 10), "unknown member")
+	assert.Equal(t, 2, messagesBefore(&ChatMember{Messages: 2, LastMessageID: 9}, 10), "message not counted yet")
+	assert.Equal(t, 2, messagesBefore(&ChatMember{Messages: 3, LastMessageID: 10}, 10), "message already counted")
+	assert.Equal(t, 4, messagesBefore(&ChatMember{Messages: 5, LastMessageID: 12}, 10), "edit of an older message")
+	assert.Equal(t, 7, messagesBefore(&ChatMember{Messages: 7}, 10), "seeded from stored messages")
+}
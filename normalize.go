@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables folds Cyrillic and Greek letters that look like Latin ones onto
+// their Latin twins. Patterns and text are folded the same way, so a word
+// typed in any mix of the scripts matches a pattern typed in any other mix.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'һ': 'h',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	'Ү': 'Y', 'Һ': 'H',
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// leetspeak folds digits and symbols used in place of letters. They are only
+// folded inside words (next to a letter), so prices and dates stay intact.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// isInvisible reports whether r renders as nothing: zero-width spaces and
+// joiners, the BOM, soft hyphens and similar word-splitting tricks.
+func isInvisible(r rune) bool {
+	switch {
+	case r >= 0x200B && r <= 0x200F, r >= 0x2060 && r <= 0x2064, r >= 0xFE00 && r <= 0xFE0F:
+		return true
+	case r == 0x00AD, r == 0x034F, r == 0x180E, r == 0xFEFF:
+		return true
+	}
+	return false
+}
+
+// foldRune normalizes a single literal rune: NFKC compatibility
+// normalization (which turns fullwidth and "fancy font" letters into plain
+// ones), dropping invisible characters and stray combining marks, and
+// confusable folding. Callers compose the text first, so accented letters
+// such as é, й and ё arrive precomposed and keep their accents; only marks
+// that composed with nothing, stacked on to split a word, are dropped.
+func foldRune(r rune) []rune {
+	var out []rune
+	for _, c := range norm.NFKC.String(string(r)) {
+		if isInvisible(c) || unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		if folded, ok := confusables[c]; ok {
+			c = folded
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// foldLeet replaces runs of leetspeak runes that touch a letter, so "fr33"
+// folds whole while "100" stays a number. Only runes marked literal are
+// considered, both for replacement and as neighbours.
+func foldLeet(runes []rune, literal []bool) {
+	isLeet := func(i int) bool {
+		_, ok := leetspeak[runes[i]]
+		return ok && literal[i]
+	}
+	isLetter := func(i int) bool {
+		return i >= 0 && i < len(runes) && literal[i] && unicode.IsLetter(runes[i])
+	}
+	for i := 0; i < len(runes); {
+		if !isLeet(i) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(runes) && isLeet(end) {
+			end++
+		}
+		if isLetter(i-1) || isLetter(end) {
+			for k := i; k < end; k++ {
+				runes[k] = leetspeak[runes[k]]
+			}
+		}
+		i = end
+	}
+}
+
+// normalizeText maps text onto the canonical form ban patterns are matched
+// against: NFKC-normalized, without invisible characters and stray combining
+// marks, with look-alike letters and in-word leetspeak folded to Latin.
+func normalizeText(text string) string {
+	var runes []rune
+	for _, r := range norm.NFKC.String(text) {
+		runes = append(runes, foldRune(r)...)
+	}
+	literal := make([]bool, len(runes))
+	for i := range literal {
+		literal[i] = true
+	}
+	foldLeet(runes, literal)
+	return string(runes)
+}
+
+// foldPattern applies normalizeText's folding to the literal characters of a
+// regexp, leaving its syntax alone: escapes, character classes and repetition
+// braces are copied verbatim. The result is matched against normalized text.
+func foldPattern(pattern string) string {
+	// Canonical composition only: NFKC could turn a fullwidth symbol into
+	// regexp syntax before the syntax is told apart from literals.
+	src := []rune(norm.NFC.String(pattern))
+	var runes []rune
+	var literal []bool
+	emit := func(r rune, isLiteral bool) {
+		runes = append(runes, r)
+		literal = append(literal, isLiteral)
+	}
+	// copyUntil copies src[i:] verbatim up to and including the first of the
+	// closing runes, honouring escapes, and returns the index after it.
+	copyUntil := func(i int, closing string) int {
+		for ; i < len(src); i++ {
+			emit(src[i], false)
+			if src[i] == '\\' && i+1 < len(src) {
+				i++
+				emit(src[i], false)
+				continue
+			}
+			if strings.ContainsRune(closing, src[i]) {
+				return i + 1
+			}
+		}
+		return i
+	}
+
+	for i := 0; i < len(src); {
+		switch r := src[i]; {
+		case r == '\\':
+			emit(r, false)
+			i++
+			if i >= len(src) {
+				break
+			}
+			emit(src[i], false)
+			i++
+			// \p{Greek}, \x{1F600} and the like carry a braced argument.
+			if i < len(src) && src[i] == '{' {
+				i = copyUntil(i, "}")
+			}
+		case r == '[':
+			emit(r, false)
+			i++
+			// A ']' right after the opening bracket (or its negation) is literal.
+			if i < len(src) && src[i] == '^' {
+				emit(src[i], false)
+				i++
+			}
+			if i < len(src) && src[i] == ']' {
+				emit(src[i], false)
+				i++
+			}
+			i = copyUntil(i, "]")
+		case r == '{':
+			i = copyUntil(i, "}")
+		case r == '(' && i+1 < len(src) && src[i+1] == '?':
+			// Group flags and names: (?i), (?i:...), (?P<name>...).
+			i = copyUntil(i, ":)>")
+		case isRegexpMeta(r):
+			emit(r, false)
+			i++
+		default:
+			for _, c := range foldRune(r) {
+				emit(c, true)
+			}
+			i++
+		}
+	}
+	foldLeet(runes, literal)
+	return string(runes)
+}
+
+// isRegexpMeta reports whether r has a syntactic meaning in a regexp outside
+// of escapes and character classes.
+func isRegexpMeta(r rune) bool {
+	switch r {
+	case '.', '+', '*', '?', '(', ')', '|', '^', '$', '}', ']':
+		return true
+	}
+	return false
+}
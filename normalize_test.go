@@ -0,0 +1,173 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "plain latin text is unchanged",
+			text: "hello world",
+			want: "hello world",
+		},
+		{
+			name: "cyrillic look-alikes fold to latin",
+			text: "сrурtо",
+			want: "crypto",
+		},
+		{
+			name: "zero-width characters are stripped",
+			text: "cr​ур‍to",
+			want: "crypto",
+		},
+		{
+			name: "fullwidth and math letters become plain",
+			text: "ｃｒｙｐｔｏ 𝐜𝐫𝐲𝐩𝐭𝐨",
+			want: "crypto crypto",
+		},
+		{
+			name: "stray combining marks are dropped",
+			text: "c\u0336r\u0336ypto",
+			want: "crypto",
+		},
+		{
+			name: "accented letters keep their accents",
+			text: "café йод ёлка",
+			want: "café йoд ёлka",
+		},
+		{
+			name: "decomposed accents are composed",
+			text: "cafe\u0301 и\u0306од",
+			want: "café йoд",
+		},
+		{
+			name: "in-word leetspeak folds",
+			text: "fr33 b1tc0in",
+			want: "free bitcoin",
+		},
+		{
+			name: "standalone numbers stay intact",
+			text: "price 100 $ at 12:30",
+			want: "price 100 $ at 12:30",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeText(tt.text))
+		})
+	}
+}
+
+func TestFoldPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+	}{
+		{
+			name:    "literal look-alikes fold",
+			pattern: "крипта",
+			want:    "kpипta",
+		},
+		{
+			name:    "escapes are kept verbatim",
+			pattern: `\d+ \s\w`,
+			want:    `\d+ \s\w`,
+		},
+		{
+			name:    "character classes are kept verbatim",
+			pattern: "[ао0]k",
+			want:    "[ао0]k",
+		},
+		{
+			name:    "repetition braces are kept verbatim",
+			pattern: `x{1,3}`,
+			want:    `x{1,3}`,
+		},
+		{
+			name:    "group flags and names are kept verbatim",
+			pattern: `(?i:b)(?P<name>0)`,
+			want:    `(?i:b)(?P<name>0)`,
+		},
+		{
+			name:    "unicode class arguments are kept verbatim",
+			pattern: `\p{Greek}о`,
+			want:    `\p{Greek}o`,
+		},
+		{
+			name:    "leetspeak next to a literal letter folds",
+			pattern: "fr33",
+			want:    "free",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := foldPattern(tt.pattern)
+			assert.Equal(t, tt.want, got)
+			_, err := regexp.Compile(got)
+			assert.NoError(t, err, "folded pattern must stay a valid regexp")
+		})
+	}
+}
+
+func TestMatchBanPattern(t *testing.T) {
+	patterns := []string{`crypto\s+signals`, "заработок"}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "plain match",
+			text: "Join CRYPTO signals now",
+			want: `crypto\s+signals`,
+		},
+		{
+			name: "mixed script spelling matches after folding",
+			text: "join сrурtо signals now",
+			want: `crypto\s+signals`,
+		},
+		{
+			name: "zero-width split word matches",
+			text: "лёгкий зара​боток",
+			want: "заработок",
+		},
+		{
+			name: "no match",
+			text: "good morning",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchBanPattern(patterns, tt.text))
+		})
+	}
+}
+
+func TestFormatPatternTest(t *testing.T) {
+	got := formatPatternTest("сrурtо", []string{"crypto", "spam", "("})
+	lines := []string{
+		"Текст: сrурtо",
+		"Нормализованный: crypto",
+		"crypto — совпадает после нормализации",
+	}
+	for _, line := range lines {
+		assert.Contains(t, got, line)
+	}
+	assert.NotContains(t, got, "spam —")
+	assert.Contains(t, got, "( — некорректное выражение")
+
+	require.Contains(t, formatPatternTest("text", nil), "Паттерны не настроены")
+	assert.Contains(t, formatPatternTest("text", []string{"other"}), "Совпадений нет")
+}
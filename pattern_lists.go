@@ -0,0 +1,246 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+var (
+	patternListsMux sync.Mutex
+	patternLists    map[int64]*PatternList
+)
+
+const PATTERN_LIST_NAME_MAX_LENGTH = 32
+
+// subscribedPatterns returns the patterns of the given shared lists, skipping
+// lists that have been deleted since the chat subscribed.
+func subscribedPatterns(listIDs []int64) []string {
+	patternListsMux.Lock()
+	defer patternListsMux.Unlock()
+	var patterns []string
+	for _, id := range listIDs {
+		if list, ok := patternLists[id]; ok {
+			patterns = append(patterns, list.Patterns...)
+		}
+	}
+	return patterns
+}
+
+// sortedPatternLists returns copies of all shared lists ordered by ID, so the
+// panel shows them in creation order.
+func sortedPatternLists() []PatternList {
+	patternListsMux.Lock()
+	defer patternListsMux.Unlock()
+	lists := make([]PatternList, 0, len(patternLists))
+	for _, list := range patternLists {
+		lists = append(lists, PatternList{ID: list.ID, Name: list.Name, Patterns: slices.Clone(list.Patterns)})
+	}
+	slices.SortFunc(lists, func(a, b PatternList) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return lists
+}
+
+// getPatternList returns a copy of the shared list with the given ID.
+func getPatternList(listID int64) (PatternList, bool) {
+	patternListsMux.Lock()
+	defer patternListsMux.Unlock()
+	list, ok := patternLists[listID]
+	if !ok {
+		return PatternList{}, false
+	}
+	return PatternList{ID: list.ID, Name: list.Name, Patterns: slices.Clone(list.Patterns)}, true
+}
+
+// patternListSubscribers counts the chats subscribed to each shared list.
+func patternListSubscribers() map[int64]int {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	counts := make(map[int64]int)
+	for _, chatSettings := range settings {
+		for _, id := range chatSettings.PatternLists {
+			counts[id]++
+		}
+	}
+	return counts
+}
+
+// addGlobalPatternHandler adds a pattern to a shared list, creating the list
+// on first use. Only the super admin may use it, and only in private chat.
+// Usage: /add_global_pattern <список> <регулярное выражение>
+func addGlobalPatternHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	if update.Message.From == nil || update.Message.From.ID != superAdminID || chatID != update.Message.From.ID {
+		return
+	}
+	reply := func(text string) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   text,
+			ReplyParameters: &models.ReplyParameters{
+				ChatID:    chatID,
+				MessageID: update.Message.ID,
+			},
+		})
+	}
+
+	var name, pattern string
+	if parts := strings.SplitN(update.Message.Text, " ", 3); len(parts) == 3 {
+		name = strings.TrimSpace(parts[1])
+		pattern = strings.TrimSpace(parts[2])
+	}
+	if name == "" || pattern == "" {
+		reply("Использование: /add_global_pattern <список> <регулярное выражение>")
+		return
+	}
+	if utf8.RuneCountInString(name) > PATTERN_LIST_NAME_MAX_LENGTH {
+		reply(fmt.Sprintf("Слишком длинное имя списка, максимум %d символов", PATTERN_LIST_NAME_MAX_LENGTH))
+		return
+	}
+	if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+		reply(fmt.Sprintf("Некорректное регулярное выражение: %v", err))
+		return
+	}
+
+	patternListsMux.Lock()
+	var list *PatternList
+	var nextID int64 = 1
+	for _, l := range patternLists {
+		if strings.EqualFold(l.Name, name) {
+			list = l
+		}
+		if l.ID >= nextID {
+			nextID = l.ID + 1
+		}
+	}
+	if list == nil {
+		list = &PatternList{ID: nextID, Name: name}
+		patternLists[list.ID] = list
+	}
+	exists := slices.Contains(list.Patterns, pattern)
+	if !exists {
+		list.Patterns = append(list.Patterns, pattern)
+		writePatternList(ctx, list)
+	}
+	listName := list.Name
+	patternListsMux.Unlock()
+
+	if exists {
+		reply(fmt.Sprintf("Паттерн уже есть в списке «%s»", listName))
+		return
+	}
+	zap.S().Infof("[addGlobalPatternHandler] list=%q pattern=%q added", listName, pattern)
+	reply(fmt.Sprintf("Паттерн добавлен в список «%s»: %s", listName, pattern))
+}
+
+// renderPatternListsPage builds the super admin's overview of the shared lists.
+func renderPatternListsPage() (text string, kb *models.InlineKeyboardMarkup) {
+	lists := sortedPatternLists()
+	if len(lists) == 0 {
+		return "Общих списков паттернов пока нет.\nСоздать: /add_global_pattern <список> <регулярное выражение>", getPatternListsKeyboard(lists)
+	}
+	subscribers := patternListSubscribers()
+	rows := make([]string, 0, len(lists)+1)
+	rows = append(rows, "Общие списки паттернов:")
+	for _, list := range lists {
+		rows = append(rows, fmt.Sprintf("%s — паттернов: %d, чатов: %d", list.Name, len(list.Patterns), subscribers[list.ID]))
+	}
+	return strings.Join(rows, "\n"), getPatternListsKeyboard(lists)
+}
+
+// renderPatternListPage builds the page of a single shared list with a delete
+// button per pattern.
+func renderPatternListPage(listID int64) (text string, kb *models.InlineKeyboardMarkup) {
+	list, ok := getPatternList(listID)
+	if !ok {
+		return renderPatternListsPage()
+	}
+	rows := make([]string, 0, len(list.Patterns)+1)
+	rows = append(rows, fmt.Sprintf("Список «%s»:", list.Name))
+	if len(list.Patterns) == 0 {
+		rows = append(rows, "Паттернов нет")
+	}
+	for i, p := range list.Patterns {
+		rows = append(rows, fmt.Sprintf("%d. %s", i+1, p))
+	}
+	return strings.Join(rows, "\n"), getPatternListKeyboard(list)
+}
+
+// renderChatPatternListsPage builds the subscription page of a chat: one
+// toggle per shared list.
+func renderChatPatternListsPage(chatID int64) (text string, kb *models.InlineKeyboardMarkup) {
+	lists := sortedPatternLists()
+
+	settingsMux.Lock()
+	var subscribed []int64
+	if chatSettings, ok := settings[chatID]; ok {
+		subscribed = slices.Clone(chatSettings.PatternLists)
+	}
+	settingsMux.Unlock()
+
+	text = fmt.Sprintf("Общие списки паттернов для чата: %s", getChatNameFromSettings(chatID))
+	if len(lists) == 0 {
+		text = "Общих списков паттернов пока нет"
+	}
+	return text, getChatPatternListsKeyboard(chatID, lists, subscribed)
+}
+
+// togglePatternListSubscription subscribes the chat to the list or removes the
+// subscription, and reports whether the chat is subscribed afterwards.
+func togglePatternListSubscription(ctx context.Context, chatID int64, listID int64) bool {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	chatSettings := getChatSettings(ctx, chatID)
+	subscribed := true
+	if i := slices.Index(chatSettings.PatternLists, listID); i >= 0 {
+		chatSettings.PatternLists = slices.Delete(chatSettings.PatternLists, i, i+1)
+		subscribed = false
+	} else {
+		chatSettings.PatternLists = append(chatSettings.PatternLists, listID)
+	}
+	settings[chatID] = chatSettings
+	writeChatSettings(ctx, chatID, chatSettings)
+	return subscribed
+}
+
+// removeListPattern deletes the pattern at index from the shared list.
+func removeListPattern(ctx context.Context, listID int64, index int) (removed string, ok bool) {
+	patternListsMux.Lock()
+	defer patternListsMux.Unlock()
+	list, ok := patternLists[listID]
+	if !ok || index < 0 || index >= len(list.Patterns) {
+		return "", false
+	}
+	removed = list.Patterns[index]
+	list.Patterns = slices.Delete(list.Patterns, index, index+1)
+	writePatternList(ctx, list)
+	return removed, true
+}
+
+// removePatternList deletes a shared list and drops it from every chat that
+// subscribed to it.
+func removePatternList(ctx context.Context, listID int64) {
+	patternListsMux.Lock()
+	delete(patternLists, listID)
+	deletePatternList(ctx, listID)
+	patternListsMux.Unlock()
+
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	for chatID, chatSettings := range settings {
+		if i := slices.Index(chatSettings.PatternLists, listID); i >= 0 {
+			chatSettings.PatternLists = slices.Delete(chatSettings.PatternLists, i, i+1)
+			writeChatSettings(ctx, chatID, chatSettings)
+		}
+	}
+}
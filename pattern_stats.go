@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// recordPatternOutcome stores how a vote started by a ban pattern ended. Votes
+// started by people carry no pattern and are ignored.
+func recordPatternOutcome(ctx context.Context, s *BanInfo, outcome uint8) {
+	if s.Pattern == "" {
+		return
+	}
+	setPatternHitOutcome(ctx, s.ChatID, s.VoteMessageID, outcome)
+}
+
+// percent returns part as a whole percentage of total, 0 when total is 0.
+func percent(part, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// formatPatternStats builds the plain-text per-pattern report. Rates are
+// relative to the votes a pattern started, not counting skipped matches.
+// patterns are the chat's active patterns: those that never matched are listed
+// with no hits, and recorded patterns no longer active are marked as removed.
+func formatPatternStats(stats []PatternStats, patterns []string) string {
+	if len(stats) == 0 && len(patterns) == 0 {
+		return "Паттерны не настроены"
+	}
+	lines := []string{"Статистика паттернов:"}
+	n := 1
+	for _, st := range stats {
+		name := st.Pattern
+		if !slices.Contains(patterns, st.Pattern) {
+			name += " (удалён)"
+		}
+		votes := st.Hits - st.Skipped
+		lines = append(lines,
+			fmt.Sprintf("%d. %s", n, name),
+			fmt.Sprintf("срабатываний: %d, голосований: %d, бан: %d (%d%%), отмена: %d (%d%%), истекло: %d",
+				st.Hits, votes, st.Passed, percent(st.Passed, votes), st.Cancelled, percent(st.Cancelled, votes), st.Expired),
+			fmt.Sprintf("последнее: %s", st.LastHit.Local().Format("02.01.2006 15:04")),
+		)
+		n++
+	}
+	for _, p := range patterns {
+		if slices.ContainsFunc(stats, func(st PatternStats) bool { return st.Pattern == p }) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s", n, p), "срабатываний нет")
+		n++
+	}
+	return firstN(strings.Join(lines, "\n"), 3500)
+}
+
+// renderPatternStats loads the chat's pattern statistics as plain text.
+func renderPatternStats(ctx context.Context, chatID int64) string {
+	stats, err := getPatternStats(ctx, chatID)
+	if err != nil {
+		zap.S().Infof("[renderPatternStats] getPatternStats failed for chatID=%d: %v", chatID, err)
+		return "Не удалось получить статистику"
+	}
+	patterns, _ := chatBanPatterns(chatID)
+	return formatPatternStats(stats, patterns)
+}
+
+// patternStatsHandler shows how often each ban pattern matched in the chat and
+// how the resulting votes ended.
+// Usage: /pattern_stats
+func patternStatsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(renderPatternStats(ctx, chatID)), true, 120)
+}
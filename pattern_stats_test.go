@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPatternStats(t *testing.T) {
+	lastHit := time.Date(2026, 10, 18, 14, 3, 0, 0, time.Local)
+
+	t.Run("nothing configured", func(t *testing.T) {
+		assert.Equal(t, "Паттерны не настроены", formatPatternStats(nil, nil))
+	})
+
+	t.Run("rates exclude skipped matches", func(t *testing.T) {
+		stats := []PatternStats{
+			{Pattern: "casino", Hits: 5, Passed: 2, Cancelled: 1, Expired: 1, Skipped: 1, LastHit: lastHit},
+		}
+		want := "Статистика паттернов:\n" +
+			"1. casino\n" +
+			"срабатываний: 5, голосований: 4, бан: 2 (50%), отмена: 1 (25%), истекло: 1\n" +
+			"последнее: 18.10.2026 14:03"
+		assert.Equal(t, want, formatPatternStats(stats, []string{"casino"}))
+	})
+
+	t.Run("unmatched and removed patterns", func(t *testing.T) {
+		stats := []PatternStats{
+			{Pattern: "old", Hits: 1, Skipped: 1, LastHit: lastHit},
+		}
+		want := "Статистика паттернов:\n" +
+			"1. old (удалён)\n" +
+			"срабатываний: 1, голосований: 0, бан: 0 (0%), отмена: 0 (0%), истекло: 0\n" +
+			"последнее: 18.10.2026 14:03\n" +
+			"2. fresh\n" +
+			"срабатываний нет"
+		assert.Equal(t, want, formatPatternStats(stats, []string{"fresh"}))
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// probationMessages and probationDays are the default probation terms:
+	// a newcomer is released after either.
+	probationMessages = 20
+	probationDays     = 3
+	// probationMaxMessages and probationMaxDays bound what admins may set.
+	probationMaxMessages = 1000
+	probationMaxDays     = 90
+)
+
+// chatProbation returns whether the chat puts newcomers on probation and its
+// terms, without creating a settings record.
+func chatProbation(chatID int64) (enabled bool, messages, days int) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		enabled, messages, days = chatSettings.Probation, chatSettings.ProbationMessages, chatSettings.ProbationDays
+	}
+	if messages == 0 {
+		messages = probationMessages
+	}
+	if days == 0 {
+		days = probationDays
+	}
+	return enabled, messages, days
+}
+
+// probationServed reports whether the member has met either probation term
+// since their probation began.
+func probationServed(member *ChatMember, messages, days int, now time.Time) bool {
+	return member.Messages-member.ProbationBase >= messages || !now.Before(member.ProbationSince.AddDate(0, 0, days))
+}
+
+// hasChatHistory reports whether a member would have served probation by
+// now had it started when they first came, as a rejoining regular would.
+func hasChatHistory(member *ChatMember, messages, days int, now time.Time) bool {
+	return member.Messages >= messages || !now.Before(member.FirstSeen.AddDate(0, 0, days))
+}
+
+// restrictToText lets a member send text messages only, with no end date.
+func restrictToText(ctx context.Context, b *bot.Bot, chatID, userID int64) bool {
+	if _, err := b.RestrictChatMember(ctx, &bot.RestrictChatMemberParams{
+		ChatID: chatID,
+		UserID: userID,
+		Permissions: &models.ChatPermissions{
+			CanSendMessages: true,
+		},
+		UseIndependentChatPermissions: false,
+	}); err != nil {
+		zap.S().Infof("[restrictToText] RestrictChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+		return false
+	}
+	return true
+}
+
+// startProbation limits a member to text until they serve the chat's
+// probation. Members who have served it already, say on rejoining, are left
+// alone; it reports whether probation started.
+func startProbation(ctx context.Context, b *bot.Bot, chatID, userID int64) bool {
+	_, messages, days := chatProbation(chatID)
+	if member, err := getChatMember(ctx, chatID, userID); err == nil && hasChatHistory(member, messages, days, time.Now()) {
+		return false
+	}
+	if !restrictToText(ctx, b, chatID, userID) {
+		return false
+	}
+	startChatMemberProbation(ctx, chatID, userID)
+	zap.S().Infof("[startProbation] chatID=%d userID=%d on probation", chatID, userID)
+	return true
+}
+
+// releaseNewcomer lifts the full restriction of a newcomer who passed the
+// captcha or was let in after a raid: they go on probation when the chat has
+// it on, or get the chat's default permissions.
+func releaseNewcomer(ctx context.Context, b *bot.Bot, chatID, userID int64) {
+	if enabled, _, _ := chatProbation(chatID); enabled && startProbation(ctx, b, chatID, userID) {
+		return
+	}
+	restoreDefaultPermissions(ctx, b, chatID, userID)
+}
+
+// endProbation takes the member off probation and gives them the chat's
+// default permissions, unless they left or a timed restriction, such as a mute
+// by vote, is in force now.
+func endProbation(ctx context.Context, b *bot.Bot, chatID, userID int64) {
+	endChatMemberProbation(ctx, chatID, userID)
+	member, err := b.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chatID, UserID: userID})
+	if err != nil {
+		zap.S().Infof("[endProbation] GetChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+		return
+	}
+	if !isChatMemberPresent(*member) || (member.Restricted != nil && member.Restricted.UntilDate != 0) {
+		return
+	}
+	restoreDefaultPermissions(ctx, b, chatID, userID)
+	zap.S().Infof("[endProbation] chatID=%d userID=%d released from probation", chatID, userID)
+}
+
+// releaseProbations ends the probation of members who have served it and of
+// everyone in chats that turned probation off.
+func releaseProbations(ctx context.Context) {
+	members, err := getProbationMembers(ctx)
+	if err != nil {
+		zap.S().Infof("[releaseProbations] getProbationMembers failed: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range members {
+		member := &members[i]
+		enabled, messages, days := chatProbation(member.ChatID)
+		if enabled && !probationServed(member, messages, days, now) {
+			continue
+		}
+		endProbation(ctx, myBot, member.ChatID, member.UserID)
+	}
+}
+
+// probationStatus describes the member's probation in the chat for /check;
+// empty when they are not on probation.
+func probationStatus(ctx context.Context, chatID, userID int64) string {
+	member, err := getChatMember(ctx, chatID, userID)
+	if err != nil || !member.Probation {
+		return ""
+	}
+	_, messages, days := chatProbation(chatID)
+	return formatProbationStatus(member, messages, days)
+}
+
+// formatProbationStatus describes what is left of a member's probation.
+func formatProbationStatus(member *ChatMember, messages, days int) string {
+	left := max(messages-(member.Messages-member.ProbationBase), 0)
+	return fmt.Sprintf("На испытательном сроке: осталось сообщений — %d, или до %s",
+		left, member.ProbationSince.AddDate(0, 0, days).Local().Format("02.01.2006 15:04"))
+}
+
+// probationTarget returns the user a /probation command is about: the author
+// of the replied message or the mentioned user.
+func probationTarget(ctx context.Context, msg *models.Message) (int64, bool) {
+	for _, v := range msg.Entities {
+		switch v.Type {
+		case models.MessageEntityTypeTextMention:
+			return v.User.ID, true
+		case models.MessageEntityTypeMention:
+			user, err := getUserByUsername(ctx, entityText(msg.Text, v.Offset+1, v.Length-1))
+			if err != nil {
+				return 0, false
+			}
+			return user.Uid, true
+		}
+	}
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil {
+		return msg.ReplyToMessage.From.ID, true
+	}
+	return 0, false
+}
+
+// probationHandler shows or configures the chat's probation for newcomers,
+// and puts a member on probation or ends it by hand.
+// Usage: /probation [on [сообщений] [дней] | off | start @user | end @user]
+func probationHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	usage := "Использование: /probation on [сообщений] [дней], /probation off, " +
+		"/probation start @user или /probation end @user (или ответом на сообщение)"
+
+	switch {
+	case len(args) == 0:
+		enabled, messages, days := chatProbation(chatID)
+		status := "выключен"
+		if enabled {
+			status = fmt.Sprintf("включён: только текст до %d сообщений или %d дней в чате", messages, days)
+		}
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Испытательный срок для новых участников %s\n\n%s", status, usage)), true, 60)
+		return
+	case strings.EqualFold(args[0], "start") || strings.EqualFold(args[0], "end"):
+		userID, ok := probationTarget(ctx, update.Message)
+		if !ok {
+			systemAnswerToMessage(ctx, b, chatID, msgID, escape("Пользователь не найден\n\n"+usage), true, 30)
+			return
+		}
+		result := "Испытательный срок завершён"
+		if strings.EqualFold(args[0], "start") {
+			if enabled, _, _ := chatProbation(chatID); !enabled {
+				// The ticker would release them at once.
+				systemAnswerToMessage(ctx, b, chatID, msgID, escape("Сначала включите испытательный срок: /probation on"), true, 30)
+				return
+			}
+			result = "Пользователь на испытательном сроке"
+			if !restrictToText(ctx, b, chatID, userID) {
+				systemAnswerToMessage(ctx, b, chatID, msgID, escape("Не удалось ограничить пользователя"), true, 30)
+				return
+			}
+			startChatMemberProbation(ctx, chatID, userID)
+		} else {
+			endProbation(ctx, b, chatID, userID)
+		}
+		zap.S().Infof("[probationHandler] chatID=%d %s userID=%d by userID=%d", chatID, args[0], userID, update.Message.From.ID)
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+		return
+	}
+
+	var enable bool
+	var messages, days int
+	switch {
+	case strings.EqualFold(args[0], "on") && len(args) <= 3:
+		enable = true
+		var err error
+		if len(args) >= 2 {
+			if messages, err = strconv.Atoi(args[1]); err != nil || messages < 1 || messages > probationMaxMessages {
+				systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Число сообщений — от 1 до %d", probationMaxMessages)), true, 30)
+				return
+			}
+		}
+		if len(args) == 3 {
+			if days, err = strconv.Atoi(args[2]); err != nil || days < 1 || days > probationMaxDays {
+				systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Число дней — от 1 до %d", probationMaxDays)), true, 30)
+				return
+			}
+		}
+	case strings.EqualFold(args[0], "off") && len(args) == 1:
+	default:
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	chatSettings.Probation = enable
+	if messages != 0 {
+		chatSettings.ProbationMessages = messages
+	}
+	if days != 0 {
+		chatSettings.ProbationDays = days
+	}
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[probationHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	result := "Испытательный срок выключен, ограничения с участников на испытательном сроке будут сняты в течение минуты"
+	if enable {
+		_, messages, days = chatProbation(chatID)
+		result = fmt.Sprintf("Испытательный срок включён: новые участники пишут только текст до %d сообщений или %d дней в чате. Боту нужны права на блокировку участников", messages, days)
+	}
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(result), true, 30)
+}
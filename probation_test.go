@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbationServed(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		member ChatMember
+		want   bool
+	}{
+		{name: "fresh", member: ChatMember{Messages: 5, ProbationSince: now.Add(-time.Hour)}},
+		{name: "enough messages", member: ChatMember{Messages: 20, ProbationSince: now.Add(-time.Hour)}, want: true},
+		{name: "messages before probation do not count", member: ChatMember{Messages: 25, ProbationBase: 10, ProbationSince: now.Add(-time.Hour)}},
+		{name: "enough days", member: ChatMember{Messages: 1, ProbationSince: now.AddDate(0, 0, -3)}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, probationServed(&tt.member, 20, 3, now))
+		})
+	}
+}
+
+func TestHasChatHistory(t *testing.T) {
+	now := time.Now()
+	assert.False(t, hasChatHistory(&ChatMember{Messages: 3, FirstSeen: now.Add(-time.Hour)}, 20, 3, now))
+	assert.True(t, hasChatHistory(&ChatMember{Messages: 30, FirstSeen: now.Add(-time.Hour)}, 20, 3, now))
+	assert.True(t, hasChatHistory(&ChatMember{Messages: 1, FirstSeen: now.AddDate(-1, 0, 0)}, 20, 3, now))
+}
+
+func TestFormatProbationStatus(t *testing.T) {
+	since := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	member := &ChatMember{Messages: 12, ProbationBase: 4, ProbationSince: since}
+	assert.Equal(t, "На испытательном сроке: осталось сообщений — 12, или до 04.03.2026 12:00", formatProbationStatus(member, 20, 3))
+
+	member.Messages = 40
+	assert.Equal(t, "На испытательном сроке: осталось сообщений — 0, или до 04.03.2026 12:00", formatProbationStatus(member, 20, 3))
+}
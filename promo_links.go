@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/ice2heart/poke_bot/cache"
+)
+
+const (
+	// promoMaxMessages is the default for the promo rule's max_messages: only
+	// authors with at most this many messages are checked.
+	promoMaxMessages = 20
+	// publicChatTTL is how long a username's resolution is remembered.
+	publicChatTTL = 24 * time.Hour
+)
+
+// The kinds of Telegram promotion the promo rule recognizes.
+const (
+	PROMO_NONE    uint8 = iota
+	PROMO_INVITE        // invite or folder link to a private chat
+	PROMO_CHANNEL       // public username; only promotion if it resolves to a chat
+	PROMO_BOT           // bot username or bot deep-link
+)
+
+var (
+	telegramHosts    = []string{"t.me", "telegram.me", "telegram.dog"}
+	telegramUsername = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{3,31}$`)
+	// publicChats caches whether a username belongs to a public channel or
+	// group, keyed by the lower-cased username.
+	publicChats *cache.Cache[string, bool]
+)
+
+// promoLink is one piece of Telegram promotion found in a message.
+type promoLink struct {
+	kind     uint8
+	username string
+	raw      string
+}
+
+func (p promoLink) label() string {
+	switch p.kind {
+	case PROMO_INVITE:
+		return "ссылка-приглашение"
+	case PROMO_BOT:
+		return "ссылка на бота"
+	}
+	return "ссылка на канал"
+}
+
+// promoRule flags invite links, public channel and group usernames and bot
+// links posted by authors with little message history.
+type promoRule struct{}
+
+func (promoRule) Name() string {
+	return "promo"
+}
+
+func (promoRule) Description() string {
+	return "приглашения, ссылки на каналы и ботов от новых участников"
+}
+
+func (promoRule) DefaultAction() uint8 {
+	return RULE_ACTION_DELETE
+}
+
+func (promoRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "max_messages", Default: promoMaxMessages, Description: "проверяются авторы, написавшие не больше стольких сообщений"},
+	}
+}
+
+func (promoRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
+	if msg == nil || isLinkedChannelPost(msg) {
+		return nil
+	}
+	promos := findPromoLinks(messageURLs(msg), messageMentions(msg), chatOwnUsernames(msg.Chat))
+	if len(promos) == 0 {
+		return nil
+	}
+
+	v := messageVerdict(msg, msg.Text, "")
+	if v.Text == "" {
+		v.Text = msg.Caption
+	}
+	if user, err := getUser(ctx, v.UserID); err == nil && int(user.Counter) > cfg.Params["max_messages"] {
+		return nil
+	}
+	for _, p := range promos {
+		if p.kind == PROMO_CHANNEL && !isPublicChat(ctx, b, p.username) {
+			continue
+		}
+		v.Evidence = fmt.Sprintf("%s %s", p.label(), p.raw)
+		return v
+	}
+	return nil
+}
+
+// messageMentions returns the @username mentions in a message's text and
+// caption, without the "@".
+func messageMentions(msg *models.Message) []string {
+	var mentions []string
+	for _, src := range []struct {
+		text     string
+		entities []models.MessageEntity
+	}{
+		{msg.Text, msg.Entities},
+		{msg.Caption, msg.CaptionEntities},
+	} {
+		for _, e := range src.entities {
+			if e.Type == models.MessageEntityTypeMention {
+				mentions = append(mentions, strings.TrimPrefix(entityText(src.text, e.Offset, e.Length), "@"))
+			}
+		}
+	}
+	return mentions
+}
+
+// chatOwnUsernames returns the usernames a chat may promote freely: its own
+// and its linked channel's.
+func chatOwnUsernames(chat models.Chat) []string {
+	own := []string{chat.Username}
+	if linkedChannel := chatLinkedChannel(chat.ID); linkedChannel != "" {
+		own = append(own, linkedChannel)
+	}
+	return own
+}
+
+// classifyTelegramLink recognizes t.me and tg:// links that promote another
+// chat or a bot and returns their kind and, unless it is an invite, the
+// promoted username.
+func classifyTelegramLink(raw string) (kind uint8, username string) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return PROMO_NONE, ""
+	}
+	query := u.Query()
+	startsBot := query.Has("start") || query.Has("startgroup") || query.Has("startapp")
+
+	if strings.EqualFold(u.Scheme, "tg") {
+		switch strings.ToLower(u.Host) {
+		case "join", "addlist":
+			return PROMO_INVITE, ""
+		case "resolve":
+			return usernamePromo(query.Get("domain"), startsBot)
+		}
+		return PROMO_NONE, ""
+	}
+
+	host := urlHost(raw)
+	for _, h := range telegramHosts {
+		// username.t.me is the same as t.me/username.
+		if name, ok := strings.CutSuffix(host, "."+h); ok {
+			return usernamePromo(name, startsBot)
+		}
+		if host != h {
+			continue
+		}
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		switch first := strings.ToLower(segments[0]); {
+		case strings.HasPrefix(first, "+"), first == "joinchat", first == "addlist":
+			return PROMO_INVITE, ""
+		case (first == "s" || first == "boost") && len(segments) > 1:
+			return usernamePromo(segments[1], startsBot)
+		default:
+			return usernamePromo(segments[0], startsBot)
+		}
+	}
+	return PROMO_NONE, ""
+}
+
+// usernamePromo classifies a promoted username. Bot usernames always end in
+// "bot"; anything else is a channel candidate until resolved.
+func usernamePromo(name string, startsBot bool) (uint8, string) {
+	if !telegramUsername.MatchString(name) {
+		return PROMO_NONE, ""
+	}
+	if startsBot || strings.HasSuffix(strings.ToLower(name), "bot") {
+		return PROMO_BOT, name
+	}
+	return PROMO_CHANNEL, name
+}
+
+// findPromoLinks returns the promotion among a message's links and mentions,
+// leaving out the chat's own usernames.
+func findPromoLinks(urls, mentions, own []string) []promoLink {
+	isOwn := func(name string) bool {
+		return slices.ContainsFunc(own, func(o string) bool { return o != "" && strings.EqualFold(o, name) })
+	}
+	var promos []promoLink
+	for _, raw := range urls {
+		kind, name := classifyTelegramLink(raw)
+		if kind == PROMO_NONE || isOwn(name) {
+			continue
+		}
+		promos = append(promos, promoLink{kind: kind, username: name, raw: raw})
+	}
+	for _, name := range mentions {
+		kind, name := usernamePromo(name, false)
+		if kind == PROMO_NONE || isOwn(name) {
+			continue
+		}
+		promos = append(promos, promoLink{kind: kind, username: name, raw: "@" + name})
+	}
+	return promos
+}
+
+// isPublicChat reports whether username belongs to a public channel or group.
+// The Bot API does not resolve user usernames, so those come back false.
+func isPublicChat(ctx context.Context, b *bot.Bot, username string) bool {
+	key := strings.ToLower(username)
+	if public, ok := publicChats.Get(key); ok {
+		return public
+	}
+	chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: "@" + username})
+	public := err == nil && chat.Type != models.ChatTypePrivate
+	publicChats.Set(key, public, publicChatTTL)
+	return public
+}
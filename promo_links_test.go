@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyTelegramLink(t *testing.T) {
+	tests := []struct {
+		raw      string
+		wantKind uint8
+		wantName string
+	}{
+		{"https://t.me/+AbCdEf123", PROMO_INVITE, ""},
+		{"t.me/joinchat/AbCdEf123", PROMO_INVITE, ""},
+		{"https://t.me/addlist/xyz", PROMO_INVITE, ""},
+		{"tg://join?invite=AbCdEf", PROMO_INVITE, ""},
+		{"https://t.me/somechannel", PROMO_CHANNEL, "somechannel"},
+		{"telegram.me/somechannel/123", PROMO_CHANNEL, "somechannel"},
+		{"https://t.me/s/somechannel", PROMO_CHANNEL, "somechannel"},
+		{"somechannel.t.me", PROMO_CHANNEL, "somechannel"},
+		{"tg://resolve?domain=somechannel", PROMO_CHANNEL, "somechannel"},
+		{"https://t.me/CasinoBot", PROMO_BOT, "CasinoBot"},
+		{"https://t.me/casino_helper?start=ref123", PROMO_BOT, "casino_helper"},
+		{"tg://resolve?domain=casino&start=ref", PROMO_BOT, "casino"},
+		{"https://t.me/c/1234567/89", PROMO_NONE, ""},
+		{"https://t.me/", PROMO_NONE, ""},
+		{"https://example.com/+invite", PROMO_NONE, ""},
+		{"https://nott.me/somechannel", PROMO_NONE, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			kind, name := classifyTelegramLink(tt.raw)
+			assert.Equal(t, tt.wantKind, kind)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+}
+
+func TestFindPromoLinks(t *testing.T) {
+	urls := []string{"https://t.me/OurChat/42", "https://t.me/ournews", "https://t.me/+secret", "https://golang.org"}
+	mentions := []string{"OURNEWS", "spam_channel", "ab", "free_money_bot"}
+	own := []string{"ourchat", "OurNews", ""}
+
+	assert.Equal(t, []promoLink{
+		{kind: PROMO_INVITE, raw: "https://t.me/+secret"},
+		{kind: PROMO_CHANNEL, username: "spam_channel", raw: "@spam_channel"},
+		{kind: PROMO_BOT, username: "free_money_bot", raw: "@free_money_bot"},
+	}, findPromoLinks(urls, mentions, own))
+
+	assert.Empty(t, findPromoLinks(nil, nil, own))
+}
+
+func TestMessageMentions(t *testing.T) {
+	msg := &models.Message{
+		Text:            "заходи в @spam_channel",
+		Entities:        []models.MessageEntity{{Type: models.MessageEntityTypeMention, Offset: 9, Length: 13}},
+		Caption:         "@other_chat",
+		CaptionEntities: []models.MessageEntity{{Type: models.MessageEntityTypeMention, Offset: 0, Length: 11}},
+	}
+	assert.Equal(t, []string{"spam_channel", "other_chat"}, messageMentions(msg))
+}
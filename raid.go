@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/ice2heart/poke_bot/cache"
+	"go.uber.org/zap"
+)
+
+const (
+	// raidJoins and raidWindow are the default raid threshold: more than
+	// raidJoins joins within raidWindow seconds.
+	raidJoins  = 10
+	raidWindow = 60
+	// raidQuietPeriod ends a raid when nobody has joined for this long.
+	raidQuietPeriod = 10 * time.Minute
+)
+
+// How a raid ended, as stored in Raid.Outcome.
+const (
+	RAID_ACTIVE  uint8 = iota // still restricting new joiners
+	RAID_EXPIRED              // ended on its own; the joiners stay restricted
+	RAID_LIFTED               // an admin ended it and lifted the joiners' restrictions
+	RAID_BANNED               // an admin banned all joiners
+)
+
+// joinEvent is one join in a chat's sliding window.
+type joinEvent struct {
+	userID int64
+	at     time.Time
+}
+
+var (
+	raidsMux sync.Mutex
+	// joinWindows holds each chat's recent joins.
+	joinWindows *cache.Cache[int64, []joinEvent]
+	// activeRaids are the chats' raids in progress; a copy of the raids
+	// collection entries with RAID_ACTIVE.
+	activeRaids = make(map[int64]*Raid)
+)
+
+// addJoinEvent appends ev to the window, dropping joins older than the window.
+func addJoinEvent(events []joinEvent, ev joinEvent, window time.Duration) []joinEvent {
+	since := ev.at.Add(-window)
+	kept := make([]joinEvent, 0, len(events)+1)
+	for _, e := range events {
+		if e.at.Before(since) || e.userID == ev.userID {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return append(kept, ev)
+}
+
+// tightenRuleConfig is a rule's configuration during a raid: rules that would
+// only notify or report delete instead.
+func tightenRuleConfig(cfg RuleConfig) RuleConfig {
+	if cfg.Action == RULE_ACTION_NOTICE || cfg.Action == RULE_ACTION_REPORT {
+		cfg.Action = RULE_ACTION_DELETE
+	}
+	return cfg
+}
+
+// chatRaidSettings returns whether the chat has raid protection on and its
+// threshold, without creating a settings record.
+func chatRaidSettings(chatID int64) (enabled bool, joins int, window int) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		enabled, joins, window = chatSettings.RaidProtection, chatSettings.RaidJoins, chatSettings.RaidWindow
+	}
+	if joins == 0 {
+		joins = raidJoins
+	}
+	if window == 0 {
+		window = raidWindow
+	}
+	return enabled, joins, window
+}
+
+// isRaidActive reports whether the chat is in raid mode.
+func isRaidActive(chatID int64) bool {
+	raidsMux.Lock()
+	defer raidsMux.Unlock()
+	_, ok := activeRaids[chatID]
+	return ok
+}
+
+// loadActiveRaids restores the raids in progress at startup.
+func loadActiveRaids(ctx context.Context) {
+	raids, err := getActiveRaids(ctx)
+	if err != nil {
+		zap.S().Infof("[loadActiveRaids] getActiveRaids failed: %v", err)
+		return
+	}
+	raidsMux.Lock()
+	defer raidsMux.Unlock()
+	for _, raid := range raids {
+		activeRaids[raid.ChatID] = raid
+	}
+	zap.S().Infof("[loadActiveRaids] %d raids in progress", len(raids))
+}
+
+// processRaidJoin counts a join towards the chat's raid threshold. It starts a
+// raid when the threshold is crossed and restricts the joiner while a raid is
+// on, reporting whether the join was part of one.
+func processRaidJoin(ctx context.Context, b *bot.Bot, chatID int64, user *models.User) bool {
+	enabled, joins, window := chatRaidSettings(chatID)
+	now := time.Now()
+
+	raidsMux.Lock()
+	if raid, ok := activeRaids[chatID]; ok {
+		raid.Joiners = append(raid.Joiners, user.ID)
+		raid.LastJoin = now
+		raidsMux.Unlock()
+		addRaidJoiner(ctx, chatID, raid.RaidID, user.ID, now)
+		restrictNewcomer(ctx, b, chatID, user.ID)
+		return true
+	}
+	if !enabled {
+		raidsMux.Unlock()
+		return false
+	}
+	events, _ := joinWindows.Get(chatID)
+	events = addJoinEvent(events, joinEvent{userID: user.ID, at: now}, time.Duration(window)*time.Second)
+	if len(events) <= joins {
+		joinWindows.Set(chatID, events, time.Duration(window)*time.Second)
+		raidsMux.Unlock()
+		return false
+	}
+	joinWindows.Delete(chatID)
+	raid := &Raid{ChatID: chatID, RaidID: now.Unix(), StartedAt: now, LastJoin: now, Outcome: RAID_ACTIVE}
+	for _, e := range events {
+		raid.Joiners = append(raid.Joiners, e.userID)
+	}
+	activeRaids[chatID] = raid
+	stored := *raid
+	stored.Joiners = append([]int64(nil), raid.Joiners...)
+	raidsMux.Unlock()
+
+	zap.S().Infof("[processRaidJoin] raid started in chatID=%d: %d joins within %ds", chatID, len(events), window)
+	insertRaid(ctx, &stored)
+	for _, userID := range stored.Joiners {
+		restrictNewcomer(ctx, b, chatID, userID)
+	}
+	systemMessage(ctx, b, chatID, escape("Слишком много вступлений: включён режим рейда, новые участники ограничены до решения администраторов"), 5*60)
+	report := fmt.Sprintf("%s\n%s", escape(getChatNameFromSettings(chatID)),
+		escape(fmt.Sprintf("Рейд: %d вступлений за %d с. Новые участники ограничиваются, правила детектора ужесточены до удаления.", len(events), window)))
+	sendReportToRecipients(ctx, b, chatID, report, getRaidKeyboard(chatID, stored.RaidID), "processRaidJoin")
+	return true
+}
+
+// expireRaids ends raids nobody has joined for raidQuietPeriod. Their joiners
+// stay restricted for the admins to decide on.
+func expireRaids(ctx context.Context) {
+	raidsMux.Lock()
+	var expired []*Raid
+	for chatID, raid := range activeRaids {
+		if time.Since(raid.LastJoin) > raidQuietPeriod {
+			expired = append(expired, raid)
+			delete(activeRaids, chatID)
+		}
+	}
+	raidsMux.Unlock()
+
+	for _, raid := range expired {
+		if !endRaid(ctx, raid.ChatID, raid.RaidID, RAID_EXPIRED, 0) {
+			// An admin decided on it from the panel meanwhile.
+			continue
+		}
+		zap.S().Infof("[expireRaids] raid in chatID=%d ended: %d joiners", raid.ChatID, len(raid.Joiners))
+		report := fmt.Sprintf("%s\n%s", escape(getChatNameFromSettings(raid.ChatID)),
+			escape(fmt.Sprintf("Рейд закончился: вступлений %d. Участники рейда остаются ограниченными.", len(raid.Joiners))))
+		sendReportToRecipients(ctx, myBot, raid.ChatID, report, getRaidKeyboard(raid.ChatID, raid.RaidID), "expireRaids")
+	}
+}
+
+// errRaidDecided is returned by finishRaid for a raid an admin has already
+// decided on.
+var errRaidDecided = errors.New("raid already decided")
+
+// finishRaid ends a raid on an admin's decision: it lifts the restrictions of
+// the raid's joiners or bans them all (RAID_LIFTED or RAID_BANNED). It returns
+// the number of joiners dealt with. Only the first decision is carried out:
+// the panel buttons stay on every report of the raid.
+func finishRaid(ctx context.Context, b *bot.Bot, chatID, raidID int64, outcome uint8, adminID int64) (int, error) {
+	if !endRaid(ctx, chatID, raidID, outcome, adminID) {
+		if _, err := getRaid(ctx, chatID, raidID); err != nil {
+			return 0, err
+		}
+		return 0, errRaidDecided
+	}
+	raidsMux.Lock()
+	if active, ok := activeRaids[chatID]; ok && active.RaidID == raidID {
+		delete(activeRaids, chatID)
+	}
+	raidsMux.Unlock()
+	raid, err := getRaid(ctx, chatID, raidID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range raid.Joiners {
+		if outcome == RAID_BANNED {
+			if _, err := b.BanChatMember(ctx, &bot.BanChatMemberParams{ChatID: chatID, UserID: userID}); err != nil {
+				zap.S().Infof("[finishRaid] BanChatMember failed for chatID=%d userID=%d: %v", chatID, userID, err)
+			}
+		} else {
+			releaseNewcomer(ctx, b, chatID, userID)
+		}
+	}
+	zap.S().Infof("[finishRaid] raid %d in chatID=%d finished with outcome=%d by userID=%d: %d joiners", raidID, chatID, outcome, adminID, len(raid.Joiners))
+	return len(raid.Joiners), nil
+}
+
+// raidCallback handles the raid panel buttons.
+func raidCallback(ctx context.Context, b *bot.Bot, update *models.Update, data *Item, outcome uint8) {
+	raidID := getInt(data.Data[DATA_TYPE_RAID])
+	count, err := finishRaid(ctx, b, data.ChatID, raidID, outcome, update.CallbackQuery.From.ID)
+	text := fmt.Sprintf("Ограничения сняты с участников рейда: %d", count)
+	switch {
+	case errors.Is(err, errRaidDecided):
+		text = "Решение по этому рейду уже принято"
+	case err != nil:
+		zap.S().Infof("[raidCallback] finishRaid failed for chatID=%d raidID=%d: %v", data.ChatID, raidID, err)
+		text = "Рейд не найден"
+	case outcome == RAID_BANNED:
+		text = fmt.Sprintf("Заблокированы участники рейда: %d", count)
+	}
+	systemAnswerToMessage(ctx, b, update.CallbackQuery.From.ID, update.CallbackQuery.Message.Message.ID, escape(text), false, 30)
+}
+
+// formatRaidSettings describes the chat's raid protection in plain text.
+func formatRaidSettings(enabled bool, joins, window int, active bool) string {
+	state := "выключена"
+	if enabled {
+		state = fmt.Sprintf("включена: рейд — больше %d вступлений за %d с", joins, window)
+	}
+	lines := []string{fmt.Sprintf("Защита от рейдов %s", state)}
+	if active {
+		lines = append(lines, "Сейчас идёт рейд: новые участники ограничиваются")
+	}
+	lines = append(lines, "", "Использование: /raid on [вступлений] [секунд] | off | start | stop")
+	return strings.Join(lines, "\n")
+}
+
+// raidHandler shows or configures the chat's raid protection, or starts and
+// stops raid mode by hand. Stopping leaves the joiners restricted; the raid
+// panel lifts or bans them.
+// Usage: /raid [on [вступлений] [секунд] | off | start | stop]
+func raidHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	showSettings := func(prefix string) {
+		enabled, joins, window := chatRaidSettings(chatID)
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(prefix+formatRaidSettings(enabled, joins, window, isRaidActive(chatID))), true, 60)
+	}
+	if len(args) == 0 {
+		showSettings("")
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on", "off":
+		enable := strings.EqualFold(args[0], "on")
+		numbers := make([]int, 0, 2)
+		for _, arg := range args[1:] {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				showSettings("Неверное число\n\n")
+				return
+			}
+			numbers = append(numbers, n)
+		}
+		if len(numbers) > 2 || (!enable && len(numbers) != 0) {
+			showSettings("")
+			return
+		}
+		settingsMux.Lock()
+		chatSettings := getChatSettings(ctx, chatID)
+		chatSettings.RaidProtection = enable
+		if len(numbers) >= 1 {
+			chatSettings.RaidJoins = numbers[0]
+		}
+		if len(numbers) == 2 {
+			chatSettings.RaidWindow = numbers[1]
+		}
+		writeChatSettings(ctx, chatID, chatSettings)
+		settingsMux.Unlock()
+		zap.S().Infof("[raidHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+		showSettings("")
+	case "start":
+		now := time.Now()
+		raid := &Raid{ChatID: chatID, RaidID: now.Unix(), StartedAt: now, LastJoin: now, Outcome: RAID_ACTIVE}
+		raidsMux.Lock()
+		_, running := activeRaids[chatID]
+		if !running {
+			activeRaids[chatID] = raid
+		}
+		raidsMux.Unlock()
+		if running {
+			showSettings("")
+			return
+		}
+		insertRaid(ctx, raid)
+		zap.S().Infof("[raidHandler] raid mode started in chatID=%d by userID=%d", chatID, update.Message.From.ID)
+		report := fmt.Sprintf("%s\n%s", escape(getChatNameFromSettings(chatID)), escape("Режим рейда включён администратором"))
+		sendReportToRecipients(ctx, b, chatID, report, getRaidKeyboard(chatID, raid.RaidID), "raidHandler")
+		showSettings("Режим рейда включён\n\n")
+	case "stop":
+		raidsMux.Lock()
+		raid, running := activeRaids[chatID]
+		delete(activeRaids, chatID)
+		raidsMux.Unlock()
+		if !running {
+			showSettings("Рейда нет\n\n")
+			return
+		}
+		endRaid(ctx, chatID, raid.RaidID, RAID_EXPIRED, update.Message.From.ID)
+		zap.S().Infof("[raidHandler] raid mode stopped in chatID=%d by userID=%d", chatID, update.Message.From.ID)
+		showSettings("Режим рейда выключен, участники рейда остаются ограниченными\n\n")
+	default:
+		showSettings("")
+	}
+}
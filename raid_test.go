@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddJoinEvent(t *testing.T) {
+	now := time.Now()
+	window := time.Minute
+	events := []joinEvent{
+		{userID: 1, at: now.Add(-2 * time.Minute)},
+		{userID: 2, at: now.Add(-30 * time.Second)},
+		{userID: 3, at: now.Add(-10 * time.Second)},
+	}
+
+	got := addJoinEvent(events, joinEvent{userID: 4, at: now}, window)
+	assert.Equal(t, []joinEvent{events[1], events[2], {userID: 4, at: now}}, got)
+
+	// A user leaving and joining again counts once.
+	got = addJoinEvent(events, joinEvent{userID: 3, at: now}, window)
+	assert.Equal(t, []joinEvent{events[1], {userID: 3, at: now}}, got)
+}
+
+func TestTightenRuleConfig(t *testing.T) {
+	tests := []struct {
+		action uint8
+		want   uint8
+	}{
+		{RULE_ACTION_NOTICE, RULE_ACTION_DELETE},
+		{RULE_ACTION_REPORT, RULE_ACTION_DELETE},
+		{RULE_ACTION_DELETE, RULE_ACTION_DELETE},
+		{RULE_ACTION_VOTE, RULE_ACTION_VOTE},
+		{RULE_ACTION_MUTE, RULE_ACTION_MUTE},
+	}
+	for _, tt := range tests {
+		cfg := RuleConfig{Action: tt.action, Shadow: true, Params: map[string]int{"x": 1}}
+		got := tightenRuleConfig(cfg)
+		assert.Equal(t, tt.want, got.Action)
+		assert.True(t, got.Shadow)
+		assert.Equal(t, cfg.Params, got.Params)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// ratingHalfLife is the default number of days after which activity
+	// counts half as much towards the recent rating.
+	ratingHalfLife = 180
+	// ratingMinHalfLife and ratingMaxHalfLife bound what admins may set.
+	ratingMinHalfLife = 7
+	ratingMaxHalfLife = 3650
+	// ratingHorizon is how many half-lives back activity is read; older
+	// activity counts for less than a thousandth.
+	ratingHorizon = 10
+)
+
+// chatRatingHalfLife returns the chat's rating half-life in days, without
+// creating a settings record.
+func chatRatingHalfLife(chatID int64) int {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok && chatSettings.RatingHalfLife != 0 {
+		return chatSettings.RatingHalfLife
+	}
+	return ratingHalfLife
+}
+
+// decayedRating sums the activity the way UserRecord.rating sums counters,
+// each day's weight halving every halfLife days before today.
+func decayedRating(buckets []ActivityBucket, today int64, halfLife int) int {
+	total := 0.0
+	for _, bucket := range buckets {
+		points := bucket.Messages + bucket.Frags*VOTE_RATING_MULTIPLY + bucket.Karma*KARMA_RATING_MULTIPLY
+		age := float64(max(today-bucket.Day, 0))
+		total += float64(points) * math.Exp2(-age/float64(halfLife))
+	}
+	return int(math.Round(total))
+}
+
+// recentRating is the user's rating with old activity decayed by the chat's
+// half-life. Users without recorded activity have none.
+func recentRating(ctx context.Context, chatID, userID int64) int {
+	halfLife := chatRatingHalfLife(chatID)
+	today := activityDay(time.Now())
+	buckets, err := getActivity(ctx, userID, today-int64(halfLife*ratingHorizon))
+	if err != nil {
+		zap.S().Infof("[recentRating] getActivity failed for userID=%d: %v", userID, err)
+		return 0
+	}
+	return decayedRating(buckets, today, halfLife)
+}
+
+// ratingDecayHandler shows or sets the chat's rating half-life.
+// Usage: /rating_decay [дней]
+func ratingDecayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	usage := fmt.Sprintf("Использование: /rating_decay <дней от %d до %d>", ratingMinHalfLife, ratingMaxHalfLife)
+
+	if len(args) == 0 {
+		systemAnswerToMessage(ctx, b, chatID, msgID,
+			escape(fmt.Sprintf("Активность в рейтинге весит вдвое меньше каждые %d дней\n\n%s", chatRatingHalfLife(chatID), usage)), true, 60)
+		return
+	}
+	days, err := strconv.Atoi(args[0])
+	if len(args) != 1 || err != nil || days < ratingMinHalfLife || days > ratingMaxHalfLife {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	chatSettings.RatingHalfLife = days
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[ratingDecayHandler] chatID=%d half-life=%d by userID=%d", chatID, days, update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID,
+		escape(fmt.Sprintf("Теперь активность в рейтинге весит вдвое меньше каждые %d дней", days)), true, 30)
+}
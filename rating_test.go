@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayedRating(t *testing.T) {
+	const today = 20000
+	tests := []struct {
+		name    string
+		buckets []ActivityBucket
+		want    int
+	}{
+		{name: "no activity"},
+		{name: "today counts in full", buckets: []ActivityBucket{{Day: today, Messages: 30, Frags: 1, Karma: 5}}, want: 30 + VOTE_RATING_MULTIPLY + 5*KARMA_RATING_MULTIPLY},
+		{name: "one half-life ago counts half", buckets: []ActivityBucket{{Day: today - 180, Messages: 100}}, want: 50},
+		{name: "three years ago is nearly gone", buckets: []ActivityBucket{{Day: today - 3*365, Messages: 1000}}, want: 15},
+		{name: "negative karma lowers it", buckets: []ActivityBucket{{Day: today, Messages: 10, Karma: -3}}, want: 4},
+		{
+			name: "days add up",
+			buckets: []ActivityBucket{
+				{Day: today, Messages: 10},
+				{Day: today - 360, Messages: 40},
+			},
+			want: 20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, decayedRating(tt.buckets, today, 180))
+		})
+	}
+}
+
+func TestActivityDay(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, activityDay(day), activityDay(day.Add(23*time.Hour)))
+	assert.Equal(t, activityDay(day)+1, activityDay(day.Add(24*time.Hour)))
+}
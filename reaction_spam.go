@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/ice2heart/poke_bot/cache"
+)
+
+// Defaults of the reaction_spam rule parameters.
+const (
+	reactionSpamWindowSec   = 600
+	reactionSpamThreshold   = 15
+	reactionSpamMaxMessages = 20
+	reactionSpamCooldownSec = 6 * 60 * 60
+)
+
+// reactionEvent is one reaction in a user's sliding window.
+type reactionEvent struct {
+	messageID int
+	at        time.Time
+}
+
+var (
+	reactionSpamMux sync.Mutex
+	// reactionWindows holds each user's recent reactions per chat; an entry
+	// expires once the user stops reacting for a whole window.
+	reactionWindows *cache.Cache[reactionKey, []reactionEvent]
+	// reactionSpamReported remembers recently reported users.
+	reactionSpamReported *cache.Cache[reactionKey, struct{}]
+)
+
+// addReactionEvent appends ev to the window, dropping events older than the
+// window and an earlier reaction to the same message, so the window length is
+// the number of distinct messages reacted to.
+func addReactionEvent(events []reactionEvent, ev reactionEvent, window time.Duration) []reactionEvent {
+	since := ev.at.Add(-window)
+	kept := make([]reactionEvent, 0, len(events)+1)
+	for _, e := range events {
+		if e.at.Before(since) || e.messageID == ev.messageID {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return append(kept, ev)
+}
+
+// reactionSpamRule flags members with little history in the chat who react
+// to many messages within minutes, a pattern of accounts farming attention.
+// Its verdicts are about the member, not a message.
+type reactionSpamRule struct{}
+
+func (reactionSpamRule) Name() string {
+	return "reaction_spam"
+}
+
+func (reactionSpamRule) Description() string {
+	return "массовые реакции от участников без истории в чате"
+}
+
+func (reactionSpamRule) DefaultAction() uint8 {
+	return RULE_ACTION_REPORT
+}
+
+func (reactionSpamRule) Params() []RuleParam {
+	return []RuleParam{
+		{Name: "threshold", Default: reactionSpamThreshold, Description: "реакции на столько разных сообщений за окно"},
+		{Name: "window", Default: reactionSpamWindowSec, Description: "окно в секундах"},
+		{Name: "max_messages", Default: reactionSpamMaxMessages, Description: "участники с большим числом сообщений в чате не проверяются"},
+		{Name: "cooldown", Default: reactionSpamCooldownSec, Description: "секунд до повторного срабатывания на того же участника"},
+	}
+}
+
+// Check records a reaction and flags the user once they have reacted to too
+// many messages within the window.
+func (reactionSpamRule) Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict {
+	r := update.MessageReaction
+	if r == nil {
+		return nil
+	}
+	userID, _, newEmojis := extractNewEmojis(r)
+	if userID == 0 || len(newEmojis) == 0 {
+		return nil
+	}
+	key := reactionKey{chatID: r.Chat.ID, userID: userID}
+	window := time.Duration(cfg.Params["window"]) * time.Second
+
+	reactionSpamMux.Lock()
+	events, _ := reactionWindows.Get(key)
+	events = addReactionEvent(events, reactionEvent{messageID: r.MessageID, at: time.Unix(int64(r.Date), 0)}, window)
+	reactionWindows.Set(key, events, window)
+	_, reported := reactionSpamReported.Get(key)
+	flagged := len(events) >= cfg.Params["threshold"] && !reported
+	if flagged {
+		// Claim the cooldown now so concurrent reactions do not flag twice;
+		// exempt users are not looked up again until it ends either.
+		reactionSpamReported.Set(key, struct{}{}, time.Duration(cfg.Params["cooldown"])*time.Second)
+	}
+	reactionSpamMux.Unlock()
+	if !flagged {
+		return nil
+	}
+
+	messages := 0
+	if member, err := getChatMember(ctx, r.Chat.ID, userID); err == nil {
+		messages = member.Messages
+	}
+	if messages > cfg.Params["max_messages"] {
+		return nil
+	}
+	evidence := fmt.Sprintf("реакции на %d сообщений за %d мин, сообщений в чате: %d",
+		len(events), int(window.Minutes()), messages)
+	return &Verdict{
+		ChatID:   r.Chat.ID,
+		UserID:   userID,
+		Text:     "Массовые реакции: " + evidence,
+		Evidence: evidence,
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddReactionEvent(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name   string
+		events []reactionEvent
+		ev     reactionEvent
+		want   []int
+	}{
+		{
+			name: "first reaction",
+			ev:   reactionEvent{messageID: 1, at: at(0)},
+			want: []int{1},
+		},
+		{
+			name:   "distinct messages accumulate",
+			events: []reactionEvent{{1, at(0)}, {2, at(1)}},
+			ev:     reactionEvent{messageID: 3, at: at(2)},
+			want:   []int{1, 2, 3},
+		},
+		{
+			name:   "reacting to the same message again counts once",
+			events: []reactionEvent{{1, at(0)}, {2, at(1)}},
+			ev:     reactionEvent{messageID: 1, at: at(2)},
+			want:   []int{2, 1},
+		},
+		{
+			name:   "events older than the window are dropped",
+			events: []reactionEvent{{1, at(0)}, {2, at(5)}},
+			ev:     reactionEvent{messageID: 3, at: at(12)},
+			want:   []int{2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addReactionEvent(tt.events, tt.ev, 10*time.Minute)
+			ids := make([]int, 0, len(got))
+			for _, e := range got {
+				ids = append(ids, e.messageID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
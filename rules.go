@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// What the detector does about a verdict. RULE_ACTION_DEFAULT in a chat's
+// RuleConfig means the rule's own default action.
+const (
+	RULE_ACTION_DEFAULT uint8 = iota
+	RULE_ACTION_NOTICE        // public auto-deleting notice in the chat
+	RULE_ACTION_REPORT        // private report to log recipients with delete/ban buttons
+	RULE_ACTION_DELETE        // delete the message and report it
+	RULE_ACTION_VOTE          // start a ban vote against the author
+	RULE_ACTION_MUTE          // delete the message and start a mute vote against the author
+)
+
+// ruleActions names the actions for commands and describes them for admins.
+var ruleActions = []struct {
+	name   string
+	action uint8
+	label  string
+}{
+	{"notice", RULE_ACTION_NOTICE, "публичное уведомление"},
+	{"report", RULE_ACTION_REPORT, "отчёт получателям логов"},
+	{"delete", RULE_ACTION_DELETE, "удаление сообщения"},
+	{"vote", RULE_ACTION_VOTE, "голосование за бан"},
+	{"mute", RULE_ACTION_MUTE, "удаление и голосование за мут"},
+}
+
+// parseRuleAction returns the action with the given command name.
+func parseRuleAction(name string) (uint8, bool) {
+	for _, a := range ruleActions {
+		if strings.EqualFold(name, a.name) {
+			return a.action, true
+		}
+	}
+	return 0, false
+}
+
+// ruleActionLabel describes a RULE_ACTION_* action for admins.
+func ruleActionLabel(action uint8) string {
+	for _, a := range ruleActions {
+		if a.action == action {
+			return a.label
+		}
+	}
+	return "по умолчанию"
+}
+
+// ruleActionNames lists the action command names joined with "|".
+func ruleActionNames() string {
+	names := make([]string, 0, len(ruleActions))
+	for _, a := range ruleActions {
+		names = append(names, a.name)
+	}
+	return strings.Join(names, "|")
+}
+
+// RuleConfig is a chat's configuration of one detector rule, stored in
+// DynamicSetting.Rules under the rule name. A rule in shadow mode only reports
+// what it would do to the log recipients.
+type RuleConfig struct {
+	Disabled bool
+	Shadow   bool
+	Action   uint8
+	Params   map[string]int
+}
+
+func (cfg *RuleConfig) clone() *RuleConfig {
+	return &RuleConfig{Disabled: cfg.Disabled, Shadow: cfg.Shadow, Action: cfg.Action, Params: maps.Clone(cfg.Params)}
+}
+
+// RuleParam describes a numeric rule parameter and its default.
+type RuleParam struct {
+	Name        string
+	Default     int
+	Description string
+}
+
+// Verdict is a rule's finding about an update: who and what it is about, why,
+// and what should be done.
+type Verdict struct {
+	Rule   string
+	Action uint8
+	ChatID int64
+	UserID int64
+	// MessageID is 0 for verdicts about the user rather than a message.
+	MessageID int64
+	// Text is the offending content, quoted in notices and reports. Verdicts
+	// about the user summarize the behaviour instead, for the vote to quote.
+	Text string
+	// Evidence explains the verdict in plain text.
+	Evidence string
+	// Pattern is the matched ban pattern, recorded for /pattern_stats.
+	Pattern string
+	// Origin is where a forwarded message came from, named when Text is
+	// shown.
+	Origin *ForwardOrigin
+	// Shadow is set when the rule runs in shadow mode.
+	Shadow bool
+}
+
+// Rule is a detector check. Check inspects an update with the chat's resolved
+// configuration (action and every parameter filled in) and returns a verdict,
+// or nil when the update is fine. Rules are listed in detectorRules.
+type Rule interface {
+	Name() string
+	Description() string
+	DefaultAction() uint8
+	Params() []RuleParam
+	Check(ctx context.Context, b *bot.Bot, update *models.Update, cfg RuleConfig) *Verdict
+}
+
+// detectorRules is the rule registry, in the order rules run and are listed.
+var detectorRules = []Rule{
+	patternRule{},
+	lateEditRule{},
+	linkDomainRule{},
+	promoRule{},
+	forwardRule{},
+	mentionRule{},
+	mediaRule{},
+	classifierRule{},
+	newcomerRule{},
+	reactionSpamRule{},
+}
+
+// findRule returns the registered rule with the given name.
+func findRule(name string) (Rule, bool) {
+	for _, r := range detectorRules {
+		if strings.EqualFold(r.Name(), name) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// ruleIndex returns the position of the rule with the given name in
+// detectorRules, -1 when there is none.
+func ruleIndex(name string) int {
+	return slices.IndexFunc(detectorRules, func(r Rule) bool {
+		return strings.EqualFold(r.Name(), name)
+	})
+}
+
+// resolveRuleConfig fills in the rule's defaults for everything the chat did
+// not configure. stored may be nil.
+func resolveRuleConfig(rule Rule, stored *RuleConfig) RuleConfig {
+	cfg := RuleConfig{Action: rule.DefaultAction(), Params: make(map[string]int)}
+	for _, p := range rule.Params() {
+		cfg.Params[p.Name] = p.Default
+	}
+	if stored == nil {
+		return cfg
+	}
+	cfg.Disabled = stored.Disabled
+	cfg.Shadow = stored.Shadow
+	if stored.Action != RULE_ACTION_DEFAULT {
+		cfg.Action = stored.Action
+	}
+	for _, p := range rule.Params() {
+		if v, ok := stored.Params[p.Name]; ok {
+			cfg.Params[p.Name] = v
+		}
+	}
+	return cfg
+}
+
+// chatRuleConfigs returns copies of the chat's rule configurations and
+// whether the chat is paused, without creating a settings record.
+func chatRuleConfigs(chatID int64) (configs map[string]*RuleConfig, paused bool) {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	chatSettings, ok := settings[chatID]
+	if !ok {
+		return nil, false
+	}
+	configs = make(map[string]*RuleConfig, len(chatSettings.Rules))
+	for name, cfg := range chatSettings.Rules {
+		configs[name] = cfg.clone()
+	}
+	return configs, chatSettings.Pause
+}
+
+// messageVerdict starts a verdict about msg, attributed to its sender chat
+// when it was sent on behalf of one.
+func messageVerdict(msg *models.Message, text, evidence string) *Verdict {
+	v := &Verdict{
+		ChatID:    msg.Chat.ID,
+		MessageID: int64(msg.ID),
+		Text:      text,
+		Evidence:  evidence,
+		Origin:    forwardOriginOf(msg),
+	}
+	if msg.SenderChat != nil {
+		v.UserID = msg.SenderChat.ID
+	} else if msg.From != nil {
+		v.UserID = msg.From.ID
+	}
+	return v
+}
+
+// runDetectorRules runs every enabled rule on a chat update and acts on their
+// verdicts. Nothing runs in private chats or while the chat is paused.
+func runDetectorRules(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := updateChatID(update)
+	if chatID >= 0 {
+		return
+	}
+	configs, paused := chatRuleConfigs(chatID)
+	if paused {
+		return
+	}
+	raid := isRaidActive(chatID)
+	for _, rule := range detectorRules {
+		cfg := resolveRuleConfig(rule, configs[rule.Name()])
+		if cfg.Disabled {
+			continue
+		}
+		if raid {
+			cfg = tightenRuleConfig(cfg)
+		}
+		v := rule.Check(ctx, b, update, cfg)
+		if v == nil {
+			continue
+		}
+		v.Rule = rule.Name()
+		v.Action = cfg.Action
+		v.Shadow = cfg.Shadow
+		handleVerdict(ctx, b, v)
+	}
+}
+
+// handleVerdict acts on a verdict unless its subject is a chat admin, and
+// records pattern matches for /pattern_stats. Shadow verdicts are only
+// reported and leave no trace in the statistics.
+func handleVerdict(ctx context.Context, b *bot.Bot, v *Verdict) {
+	zap.S().Infof("[detector] rule %q matched: userID=%d chatID=%d messageID=%d action=%d shadow=%v: %s",
+		v.Rule, v.UserID, v.ChatID, v.MessageID, v.Action, v.Shadow, v.Evidence)
+
+	// Every pattern match is recorded. It counts as skipped unless it actually
+	// starts a vote below.
+	var hit *PatternHit
+	if v.Pattern != "" && !v.Shadow {
+		hit = &PatternHit{
+			Pattern:   v.Pattern,
+			ChatID:    v.ChatID,
+			UserID:    v.UserID,
+			MessageID: v.MessageID,
+			Text:      v.Text,
+			Outcome:   HIT_SKIPPED,
+			CreatedAt: time.Now(),
+		}
+		defer pushPatternHit(ctx, hit)
+	}
+
+	adminsMux.Lock()
+	_, isAdmin := checkAdmins(ctx, b, v.ChatID)[v.UserID]
+	adminsMux.Unlock()
+	if isAdmin {
+		return
+	}
+
+	if v.Shadow {
+		report := verdictReport(ctx, v) + "\n\n" +
+			escape(fmt.Sprintf("Теневой режим, в чате ничего не сделано. Действие правила: %s", ruleActionLabel(v.Action)))
+		sendReportToRecipients(ctx, b, v.ChatID, report, verdictKeyboard(v, true), "handleVerdict")
+		return
+	}
+	if banInfo := applyVerdict(ctx, b, v); banInfo != nil && hit != nil {
+		hit.Outcome = HIT_PENDING
+		hit.VoteMessageID = banInfo.VoteMessageID
+	}
+}
+
+// verdictSubject links the verdict's message and explains the verdict, in
+// MarkdownV2.
+func verdictSubject(v *Verdict) string {
+	if v.MessageID == 0 {
+		return fmt.Sprintf("поведение: %s", escape(v.Evidence))
+	}
+	msgLink := fmt.Sprintf("tg://privatepost?channel=%s&post=%d", makePublicGroupString(v.ChatID), v.MessageID)
+	return fmt.Sprintf("[сообщение](%s): %s", msgLink, escape(v.Evidence))
+}
+
+// verdictReport describes the verdict for the log recipients, in MarkdownV2.
+func verdictReport(ctx context.Context, v *Verdict) string {
+	report := fmt.Sprintf("%s\nПравило %s, автор %s\nПодозрительное %s",
+		escape(getChatNameFromSettings(v.ChatID)), escape(v.Rule), userTagByID(ctx, v.UserID), verdictSubject(v))
+	// A verdict about the user has its summary in the subject already.
+	if v.Text != "" && v.MessageID != 0 {
+		report += "\n\n" + quoteText(withForwardOrigin(v.Origin, v.Text))
+	}
+	return report
+}
+
+// verdictKeyboard builds the buttons of a verdict report: deleting the message
+// when there is one left to delete, or starting a vote when there is none.
+func verdictKeyboard(v *Verdict, withDelete bool) *models.InlineKeyboardMarkup {
+	if v.MessageID == 0 {
+		return getUserReportKeyboard(v.ChatID, v.UserID, v.Rule)
+	}
+	return getDetectorReportKeyboard(v.ChatID, v.UserID, v.MessageID, withDelete)
+}
+
+// applyVerdict carries out the verdict's action. It returns the started vote
+// for RULE_ACTION_VOTE and RULE_ACTION_MUTE, nil otherwise.
+func applyVerdict(ctx context.Context, b *bot.Bot, v *Verdict) *BanInfo {
+	report := verdictReport(ctx, v)
+
+	switch v.Action {
+	case RULE_ACTION_REPORT:
+		sendReportToRecipients(ctx, b, v.ChatID, report, verdictKeyboard(v, true), "applyVerdict")
+	case RULE_ACTION_DELETE:
+		if v.MessageID == 0 {
+			// Nothing to delete: report only.
+			sendReportToRecipients(ctx, b, v.ChatID, report, verdictKeyboard(v, false), "applyVerdict")
+			break
+		}
+		deleteMessagesConcurrently(ctx, b, v.ChatID, []int64{v.MessageID}, "applyVerdict")
+		sendReportToRecipients(ctx, b, v.ChatID, report+"\n\nСообщение удалено",
+			getDetectorReportKeyboard(v.ChatID, v.UserID, v.MessageID, false), "applyVerdict")
+	case RULE_ACTION_VOTE:
+		// A vote already running against the author covers this verdict too.
+		if banInfo, ok := startDetectorVote(ctx, b, BAN, v.ChatID, v.UserID, v.MessageID, withForwardOrigin(v.Origin, v.Text), v.Pattern, b.ID()); ok {
+			return banInfo
+		}
+	case RULE_ACTION_MUTE:
+		if v.MessageID != 0 {
+			deleteMessagesConcurrently(ctx, b, v.ChatID, []int64{v.MessageID}, "applyVerdict")
+		}
+		// The message is gone, so the vote quotes it instead of linking to it.
+		if banInfo, ok := startDetectorVote(ctx, b, MUTE, v.ChatID, v.UserID, 0, withForwardOrigin(v.Origin, v.Text), v.Pattern, b.ID()); ok {
+			return banInfo
+		}
+	default:
+		notice := "Подозрительное " + verdictSubject(v)
+		if v.Text != "" {
+			notice += "\n\n" + quoteText(withForwardOrigin(v.Origin, v.Text))
+		}
+		systemMessage(ctx, b, v.ChatID, notice, 5*60)
+	}
+	return nil
+}
+
+// applyRuleCommand applies the /rule arguments after the rule name to cfg.
+// Usage: on | off | shadow on|off | action <действие> | set <параметр> <число>
+func applyRuleCommand(rule Rule, cfg *RuleConfig, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("не указано, что изменить")
+	}
+	switch strings.ToLower(args[0]) {
+	case "on":
+		cfg.Disabled = false
+	case "off":
+		cfg.Disabled = true
+	case "shadow":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			return fmt.Errorf("укажите shadow on или shadow off")
+		}
+		cfg.Shadow = args[1] == "on"
+	case "action":
+		if len(args) != 2 {
+			return fmt.Errorf("укажите действие: %s", ruleActionNames())
+		}
+		action, ok := parseRuleAction(args[1])
+		if !ok {
+			return fmt.Errorf("неизвестное действие %q, доступны: %s", args[1], ruleActionNames())
+		}
+		cfg.Action = action
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("укажите параметр и значение")
+		}
+		if !slices.ContainsFunc(rule.Params(), func(p RuleParam) bool { return p.Name == args[1] }) {
+			return fmt.Errorf("у правила %s нет параметра %q", rule.Name(), args[1])
+		}
+		value, err := strconv.Atoi(args[2])
+		if err != nil || value < 0 {
+			return fmt.Errorf("значение должно быть неотрицательным числом")
+		}
+		if cfg.Params == nil {
+			cfg.Params = make(map[string]int)
+		}
+		cfg.Params[args[1]] = value
+	default:
+		return fmt.Errorf("неизвестная команда %q", args[0])
+	}
+	return nil
+}
+
+// formatRule describes a rule and its resolved configuration in plain text.
+func formatRule(rule Rule, cfg RuleConfig) string {
+	state := "вкл"
+	if cfg.Disabled {
+		state = "выкл"
+	} else if cfg.Shadow {
+		state = "теневой режим"
+	}
+	lines := []string{
+		fmt.Sprintf("%s (%s) — %s", rule.Name(), state, rule.Description()),
+		fmt.Sprintf("  действие: %s", ruleActionLabel(cfg.Action)),
+	}
+	for _, p := range rule.Params() {
+		lines = append(lines, fmt.Sprintf("  %s = %d — %s", p.Name, cfg.Params[p.Name], p.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatRules lists every registered rule with the chat's configuration.
+func formatRules(configs map[string]*RuleConfig) string {
+	lines := []string{"Правила детектора:"}
+	for _, rule := range detectorRules {
+		lines = append(lines, formatRule(rule, resolveRuleConfig(rule, configs[rule.Name()])))
+	}
+	lines = append(lines, "", fmt.Sprintf("Настройка: /rule <правило> on|off|shadow on|off|action <%s>|set <параметр> <число>", ruleActionNames()))
+	return strings.Join(lines, "\n")
+}
+
+// rulesHandler lists the detector rules and their configuration in the chat.
+// Usage: /rules
+func rulesHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	configs, _ := chatRuleConfigs(chatID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatRules(configs)), true, 120)
+}
+
+// ruleHandler enables, disables or configures a detector rule in the chat.
+// Usage: /rule <правило> on|off|shadow on|off|action <действие>|set <параметр> <число>
+func ruleHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	fields := strings.Fields(update.Message.Text)
+	if len(fields) < 2 {
+		configs, _ := chatRuleConfigs(chatID)
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatRules(configs)), true, 120)
+		return
+	}
+	rule, ok := findRule(fields[1])
+	if !ok {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Правило %q не найдено, список: /rules", fields[1])), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	cfg := &RuleConfig{}
+	if stored, ok := chatSettings.Rules[rule.Name()]; ok {
+		cfg = stored.clone()
+	}
+	err := applyRuleCommand(rule, cfg, fields[2:])
+	if err == nil {
+		if chatSettings.Rules == nil {
+			chatSettings.Rules = make(map[string]*RuleConfig)
+		}
+		chatSettings.Rules[rule.Name()] = cfg
+		settings[chatID] = chatSettings
+		writeChatSettings(ctx, chatID, chatSettings)
+	}
+	settingsMux.Unlock()
+
+	if err != nil {
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("%v\n\n%s", err, formatRule(rule, resolveRuleConfig(rule, cfg)))), true, 60)
+		return
+	}
+	zap.S().Infof("[ruleHandler] chatID=%d rule=%q %v by userID=%d", chatID, rule.Name(), fields[2:], update.Message.From.ID)
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape(formatRule(rule, resolveRuleConfig(rule, cfg))), true, 60)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectorRulesAreWellFormed(t *testing.T) {
+	names := make(map[string]bool)
+	for _, rule := range detectorRules {
+		name := rule.Name()
+		assert.NotEmpty(t, name)
+		assert.False(t, names[name], "duplicate rule name %q", name)
+		names[name] = true
+		assert.NotEmpty(t, rule.Description(), name)
+		assert.NotEqual(t, "по умолчанию", ruleActionLabel(rule.DefaultAction()), "%s has no valid default action", name)
+		for _, p := range rule.Params() {
+			assert.NotEmpty(t, p.Name, name)
+			assert.NotEmpty(t, p.Description, "%s.%s", name, p.Name)
+		}
+		found, ok := findRule(name)
+		require.True(t, ok, name)
+		assert.Equal(t, name, found.Name())
+	}
+}
+
+func TestResolveRuleConfig(t *testing.T) {
+	rule := lateEditRule{}
+
+	cfg := resolveRuleConfig(rule, nil)
+	assert.False(t, cfg.Disabled)
+	assert.Equal(t, RULE_ACTION_NOTICE, cfg.Action, "unset action is the rule default")
+	assert.Equal(t, editLinkMinDelay, cfg.Params["delay"], "unset params are the rule defaults")
+
+	cfg = resolveRuleConfig(rule, &RuleConfig{
+		Disabled: true,
+		Shadow:   true,
+		Action:   RULE_ACTION_REPORT,
+		Params:   map[string]int{"delay": 600, "unknown": 1},
+	})
+	assert.True(t, cfg.Disabled)
+	assert.True(t, cfg.Shadow)
+	assert.Equal(t, RULE_ACTION_REPORT, cfg.Action)
+	assert.Equal(t, map[string]int{"delay": 600}, cfg.Params, "params the rule does not declare are ignored")
+}
+
+func TestApplyRuleCommand(t *testing.T) {
+	rule := lateEditRule{}
+	tests := []struct {
+		name    string
+		args    []string
+		want    RuleConfig
+		wantErr bool
+	}{
+		{name: "off", args: []string{"off"}, want: RuleConfig{Disabled: true}},
+		{name: "on", args: []string{"ON"}, want: RuleConfig{}},
+		{name: "shadow on", args: []string{"shadow", "on"}, want: RuleConfig{Shadow: true}},
+		{name: "shadow off", args: []string{"shadow", "off"}, want: RuleConfig{}},
+		{name: "shadow without state", args: []string{"shadow"}, wantErr: true},
+		{name: "action", args: []string{"action", "delete"}, want: RuleConfig{Action: RULE_ACTION_DELETE}},
+		{name: "set param", args: []string{"set", "delay", "300"}, want: RuleConfig{Params: map[string]int{"delay": 300}}},
+		{name: "no arguments", wantErr: true},
+		{name: "unknown action", args: []string{"action", "kick"}, wantErr: true},
+		{name: "unknown param", args: []string{"set", "speed", "1"}, wantErr: true},
+		{name: "negative value", args: []string{"set", "delay", "-1"}, wantErr: true},
+		{name: "unknown command", args: []string{"reset"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := RuleConfig{}
+			err := applyRuleCommand(rule, &cfg, tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
+
+func TestFormatRule(t *testing.T) {
+	got := formatRule(lateEditRule{}, resolveRuleConfig(lateEditRule{}, &RuleConfig{Disabled: true}))
+	assert.Contains(t, got, "late_edit (выкл)")
+	assert.Contains(t, got, "действие: публичное уведомление")
+	assert.Contains(t, got, "delay = 120")
+
+	got = formatRule(lateEditRule{}, resolveRuleConfig(lateEditRule{}, &RuleConfig{Shadow: true}))
+	assert.Contains(t, got, "late_edit (теневой режим)")
+}
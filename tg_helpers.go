@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -126,7 +127,20 @@ func getMuteMessageKeyboard(chatId int64, userId int64, voteMessageId int64) *mo
 	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
-func getChatListKeyboard(chatList []Chat) *models.InlineKeyboardMarkup {
+// actionButton builds an inline button carrying item as b_-prefixed callback
+// data. ok is false when the data cannot be marshaled.
+func actionButton(text string, item *Item) (button models.InlineKeyboardButton, ok bool) {
+	data, err := marshal(item)
+	if err != nil {
+		zap.S().Infof("[actionButton] marshal error for action=%d chatID=%d: %v", item.Action, item.ChatID, err)
+		return button, false
+	}
+	return models.InlineKeyboardButton{Text: text, CallbackData: fmt.Sprintf("b_%s", data)}, true
+}
+
+// getChatListKeyboard builds the control panel's chat list. showPatternLists
+// adds the entry to the shared pattern lists, which only the super admin manages.
+func getChatListKeyboard(chatList []Chat, showPatternLists bool) *models.InlineKeyboardMarkup {
 	buttons := make([][]models.InlineKeyboardButton, len(chatList)+1)
 	for k, v := range chatList {
 		showChat, err := marshal(&Item{
@@ -147,6 +161,11 @@ func getChatListKeyboard(chatList []Chat) *models.InlineKeyboardMarkup {
 		return nil
 	}
 	buttons[len(chatList)] = []models.InlineKeyboardButton{{Text: "🗘 Обновить", CallbackData: fmt.Sprintf("b_%s", refresh)}}
+	if showPatternLists {
+		if button, ok := actionButton("Общие списки паттернов", &Item{Action: ACTION_PATTERN_LISTS}); ok {
+			buttons = append(buttons, []models.InlineKeyboardButton{button})
+		}
+	}
 	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
 
 }
@@ -211,7 +230,7 @@ func getChatActionsKeyboard(chatID int64) *models.InlineKeyboardMarkup {
 			InlineKeyboard: [][]models.InlineKeyboardButton{},
 		}
 	}
-	return &models.InlineKeyboardMarkup{
+	keyboard := &models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
 			{
 				{Text: "Поставить чат на паузу", CallbackData: fmt.Sprintf("b_%s", pauseChat)},
@@ -221,48 +240,242 @@ func getChatActionsKeyboard(chatID int64) *models.InlineKeyboardMarkup {
 				{Text: "Включить логирование", CallbackData: fmt.Sprintf("b_%s", enableLog)},
 				{Text: "Выключить логирование", CallbackData: fmt.Sprintf("b_%s", disableLog)},
 			},
-			{
-				{Text: "Выйти из чата", CallbackData: fmt.Sprintf("b_%s", leaveChat)},
-				{Text: "К списку чатов", CallbackData: fmt.Sprintf("b_%s", refresh)},
-			},
 		},
 	}
+	var patternsRow []models.InlineKeyboardButton
+	if button, ok := actionButton("Общие списки паттернов", &Item{Action: ACTION_CHAT_PATTERN_LISTS, ChatID: chatID}); ok {
+		patternsRow = append(patternsRow, button)
+	}
+	if button, ok := actionButton("Статистика паттернов", &Item{Action: ACTION_PATTERN_STATS, ChatID: chatID}); ok {
+		patternsRow = append(patternsRow, button)
+	}
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, patternsRow)
+	keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []models.InlineKeyboardButton{
+		{Text: "Выйти из чата", CallbackData: fmt.Sprintf("b_%s", leaveChat)},
+		{Text: "К списку чатов", CallbackData: fmt.Sprintf("b_%s", refresh)},
+	})
+	return keyboard
+}
 
+// getPatternListsKeyboard builds the super admin's list of shared pattern
+// lists: one button per list and a way back to the chat list.
+func getPatternListsKeyboard(lists []PatternList) *models.InlineKeyboardMarkup {
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(lists)+1)
+	for _, list := range lists {
+		if button, ok := actionButton(list.Name, &Item{
+			Action: ACTION_SHOW_PATTERN_LIST,
+			Data:   map[uint8]interface{}{DATA_TYPE_LIST: list.ID},
+		}); ok {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+		}
+	}
+	if button, ok := actionButton("К списку чатов", &Item{Action: ACTION_SHOW_CHAT_LIST}); ok {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
-// getLikesKeyboard builds the prev/next navigation row for a paginated
-// /likes page. hasPrev/hasNext control which buttons are shown.
-func getLikesKeyboard(chatID int64, page int, hasPrev bool, hasNext bool) *models.InlineKeyboardMarkup {
+// getPatternListKeyboard builds the page of one shared list: a delete button
+// per pattern (five to a row), deleting the whole list, and going back.
+func getPatternListKeyboard(list PatternList) *models.InlineKeyboardMarkup {
+	const perRow = 5
+	var keyboard [][]models.InlineKeyboardButton
 	var row []models.InlineKeyboardButton
+	for i := range list.Patterns {
+		button, ok := actionButton(fmt.Sprintf("✖ %d", i+1), &Item{
+			Action: ACTION_DEL_LIST_PATTERN,
+			Data:   map[uint8]interface{}{DATA_TYPE_LIST: list.ID, DATA_TYPE_INDEX: i},
+		})
+		if !ok {
+			continue
+		}
+		row = append(row, button)
+		if len(row) == perRow {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	var lastRow []models.InlineKeyboardButton
+	if button, ok := actionButton("Удалить список", &Item{
+		Action: ACTION_DELETE_PATTERN_LIST,
+		Data:   map[uint8]interface{}{DATA_TYPE_LIST: list.ID},
+	}); ok {
+		lastRow = append(lastRow, button)
+	}
+	if button, ok := actionButton("К спискам", &Item{Action: ACTION_PATTERN_LISTS}); ok {
+		lastRow = append(lastRow, button)
+	}
+	keyboard = append(keyboard, lastRow)
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
 
-	if hasPrev {
-		prevData, err := marshal(&Item{
-			Action: ACTION_LIKES_PAGE,
+// getChatPatternListsKeyboard builds a chat's subscription toggles, marking
+// the lists it is subscribed to.
+func getChatPatternListsKeyboard(chatID int64, lists []PatternList, subscribed []int64) *models.InlineKeyboardMarkup {
+	keyboard := make([][]models.InlineKeyboardButton, 0, len(lists)+1)
+	for _, list := range lists {
+		mark := "▫️"
+		if slices.Contains(subscribed, list.ID) {
+			mark = "✅"
+		}
+		if button, ok := actionButton(fmt.Sprintf("%s %s (%d)", mark, list.Name, len(list.Patterns)), &Item{
+			Action: ACTION_TOGGLE_PATTERN_LIST,
 			ChatID: chatID,
-			Data:   map[uint8]interface{}{DATA_TYPE_PAGE: page - 1},
-		})
-		if err != nil {
-			zap.S().Infof("[getLikesKeyboard] marshal error for prev button chatID=%d page=%d: %v", chatID, page-1, err)
-		} else {
-			row = append(row, models.InlineKeyboardButton{Text: "◀ Пред", CallbackData: fmt.Sprintf("b_%s", prevData)})
+			Data:   map[uint8]interface{}{DATA_TYPE_LIST: list.ID},
+		}); ok {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
 		}
 	}
-	if hasNext {
-		nextData, err := marshal(&Item{
+	keyboard = append(keyboard, getBackToChatKeyboard(chatID).InlineKeyboard...)
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// getBackToChatKeyboard builds a single button returning to the chat's panel.
+func getBackToChatKeyboard(chatID int64) *models.InlineKeyboardMarkup {
+	button, ok := actionButton("Назад", &Item{Action: ACTION_SHOW_CHAT_ID, ChatID: chatID})
+	if !ok {
+		return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{button}}}
+}
+
+// getDetectorReportKeyboard builds the buttons of a detector rule report:
+// delete the message (unless it is already gone) and ban its author.
+func getDetectorReportKeyboard(chatID int64, userID int64, messageID int64, withDelete bool) *models.InlineKeyboardMarkup {
+	var row []models.InlineKeyboardButton
+	if withDelete {
+		if button, ok := actionButton("Удалить сообщение", &Item{
+			Action: ACTION_DELETE_MESSAGE,
+			ChatID: chatID,
+			Data:   map[uint8]interface{}{DATA_TYPE_MSGID: messageID},
+		}); ok {
+			row = append(row, button)
+		}
+	}
+	if button, ok := actionButton("Заблокировать", &Item{
+		Action: ACTION_BAN_USER,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_USERID: userID, DATA_TYPE_MSGID: messageID},
+	}); ok {
+		row = append(row, button)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// getUserReportKeyboard builds the buttons of a report about a user rather
+// than a message: start a ban vote or ban the user right away. rule names the
+// detector rule the vote is started for; the button carries its index in
+// detectorRules, as the name does not fit in the callback data.
+func getUserReportKeyboard(chatID int64, userID int64, rule string) *models.InlineKeyboardMarkup {
+	var row []models.InlineKeyboardButton
+	if button, ok := actionButton("Начать голосование", &Item{
+		Action: ACTION_START_VOTE,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_USERID: userID, DATA_TYPE_RULE: ruleIndex(rule)},
+	}); ok {
+		row = append(row, button)
+	}
+	if button, ok := actionButton("Заблокировать", &Item{
+		Action: ACTION_BAN_USER,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_USERID: userID},
+	}); ok {
+		row = append(row, button)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// getRaidKeyboard builds the raid panel: end the raid and lift its joiners'
+// restrictions, or ban all of them.
+func getRaidKeyboard(chatID int64, raidID int64) *models.InlineKeyboardMarkup {
+	var rows [][]models.InlineKeyboardButton
+	if button, ok := actionButton("Закончить рейд и снять ограничения", &Item{
+		Action: ACTION_END_RAID,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_RAID: raidID},
+	}); ok {
+		rows = append(rows, []models.InlineKeyboardButton{button})
+	}
+	if button, ok := actionButton("Заблокировать всех участников рейда", &Item{
+		Action: ACTION_BAN_RAID,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_RAID: raidID},
+	}); ok {
+		rows = append(rows, []models.InlineKeyboardButton{button})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// getNameCheckKeyboard builds the buttons of a suspicious name report: lift
+// the name check's restriction when there is one, and ban the user.
+func getNameCheckKeyboard(chatID int64, userID int64, restricted bool) *models.InlineKeyboardMarkup {
+	var row []models.InlineKeyboardButton
+	if restricted {
+		if button, ok := actionButton("Снять ограничения", &Item{
+			Action: ACTION_UNMUTE,
+			ChatID: chatID,
+			Data:   map[uint8]interface{}{DATA_TYPE_USERID: userID},
+		}); ok {
+			row = append(row, button)
+		}
+	}
+	if button, ok := actionButton("Заблокировать", &Item{
+		Action: ACTION_BAN_USER,
+		ChatID: chatID,
+		Data:   map[uint8]interface{}{DATA_TYPE_USERID: userID},
+	}); ok {
+		row = append(row, button)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// getLikesKeyboard builds the /likes controls: the time windows, the two
+// rankings, with the shown ones marked, and the prev/next navigation.
+// hasPrev/hasNext control which navigation buttons are shown.
+func getLikesKeyboard(chatID int64, window, view uint8, page int, hasPrev bool, hasNext bool) *models.InlineKeyboardMarkup {
+	likesButton := func(text string, window, view uint8, page int) (models.InlineKeyboardButton, bool) {
+		return actionButton(text, &Item{
 			Action: ACTION_LIKES_PAGE,
 			ChatID: chatID,
-			Data:   map[uint8]interface{}{DATA_TYPE_PAGE: page + 1},
+			Data:   map[uint8]interface{}{DATA_TYPE_PAGE: page, DATA_TYPE_WINDOW: window, DATA_TYPE_VIEW: view},
 		})
-		if err != nil {
-			zap.S().Infof("[getLikesKeyboard] marshal error for next button chatID=%d page=%d: %v", chatID, page+1, err)
-		} else {
-			row = append(row, models.InlineKeyboardButton{Text: "След ▶", CallbackData: fmt.Sprintf("b_%s", nextData)})
+	}
+	mark := func(text string, selected bool) string {
+		if selected {
+			return "• " + text
 		}
+		return text
 	}
-	if len(row) == 0 {
-		return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+
+	var windows, views, nav []models.InlineKeyboardButton
+	for i, w := range likesWindows {
+		if button, ok := likesButton(mark(w.button, uint8(i) == window), uint8(i), view, 0); ok {
+			windows = append(windows, button)
+		}
 	}
-	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+	for i, v := range likesViews {
+		if button, ok := likesButton(mark(v.button, uint8(i) == view), window, uint8(i), 0); ok {
+			views = append(views, button)
+		}
+	}
+	if hasPrev {
+		if button, ok := likesButton("◀ Пред", window, view, page-1); ok {
+			nav = append(nav, button)
+		}
+	}
+	if hasNext {
+		if button, ok := likesButton("След ▶", window, view, page+1); ok {
+			nav = append(nav, button)
+		}
+	}
+	keyboard := [][]models.InlineKeyboardButton{windows, views}
+	if len(nav) != 0 {
+		keyboard = append(keyboard, nav)
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
 }
 
 func getChatName(ctx context.Context, b *bot.Bot, chatID int64) string {
@@ -424,6 +637,7 @@ func isUserAdmin(ctx context.Context, b *bot.Bot, chatID int64, userID int64, me
 
 func updateUserFragTag(ctx context.Context, b *bot.Bot, chatID int64, ownerID int64) {
 	userMakeVote(ctx, ownerID, 1)
+	chatMemberAddFrag(ctx, chatID, ownerID)
 
 	adminsMux.Lock()
 	chatAdmins := checkAdmins(ctx, b, chatID)
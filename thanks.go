@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// thanksKarma is the karma a thanks gives the author of the message.
+	thanksKarma = 1
+	// thanksDailyLimit is how many thanks a user may give in a chat within
+	// 24 hours.
+	thanksDailyLimit = 5
+	// thanksPairCooldown is how long a user has to wait to thank the same
+	// person again.
+	thanksPairCooldown = 6 * time.Hour
+	// thanksWordMaxLength bounds trigger words admins may add.
+	thanksWordMaxLength = 32
+)
+
+// defaultThanksWords are the replies that thank the author unless the chat
+// set its own.
+var defaultThanksWords = []string{"+1", "спасибо", "спс", "благодарю", "thanks"}
+
+// thanksMux makes checking the limits and recording a thanks atomic, so two
+// quick thanks cannot both slip under a limit.
+var thanksMux sync.Mutex
+
+// chatThanksWords returns the chat's trigger words, nil when it only takes
+// /thanks, without creating a settings record.
+func chatThanksWords(chatID int64) []string {
+	settingsMux.Lock()
+	defer settingsMux.Unlock()
+	if chatSettings, ok := settings[chatID]; ok {
+		if chatSettings.ThanksWordsOff {
+			return nil
+		}
+		if len(chatSettings.ThanksWords) != 0 {
+			return slices.Clone(chatSettings.ThanksWords)
+		}
+	}
+	return slices.Clone(defaultThanksWords)
+}
+
+// isThanksMessage reports whether the text is a trigger word, or starts with
+// one followed by anything but a letter or digit ("спасибо!", "+1 к этому").
+func isThanksMessage(text string, words []string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, word := range words {
+		word = strings.ToLower(word)
+		rest, found := strings.CutPrefix(text, word)
+		if !found {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(rest)
+		if rest == "" || !(unicode.IsLetter(next) || unicode.IsDigit(next)) {
+			return true
+		}
+	}
+	return false
+}
+
+// thanksDenial explains why a user who gave the given thanks recently may not
+// thank toID now; empty when they may.
+func thanksDenial(given []ThanksRecord, toID int64, now time.Time) string {
+	today := 0
+	for _, thanks := range given {
+		if now.Sub(thanks.Date) < 24*time.Hour {
+			today++
+		}
+		if thanks.ToID == toID && now.Sub(thanks.Date) < thanksPairCooldown {
+			return fmt.Sprintf("Этого участника можно благодарить не чаще раза в %d часов", int(thanksPairCooldown.Hours()))
+		}
+	}
+	if today >= thanksDailyLimit {
+		return fmt.Sprintf("Не больше %d благодарностей в сутки", thanksDailyLimit)
+	}
+	return ""
+}
+
+// giveThanks credits the author of the message msg replies to with karma for
+// a thanks. It returns the answer for the giver: the reason it was refused,
+// or the confirmation.
+func giveThanks(ctx context.Context, msg *models.Message) (answer string, ok bool) {
+	target := msg.ReplyToMessage
+	if target == nil {
+		return "Ответьте командой на сообщение, за которое благодарите", false
+	}
+	if msg.SenderChat != nil || msg.From == nil {
+		return "Благодарить можно только от своего имени", false
+	}
+	if target.SenderChat != nil || target.From == nil || target.From.IsBot {
+		return "Благодарить можно только участников", false
+	}
+	if target.From.ID == msg.From.ID {
+		return "Нельзя благодарить самого себя", false
+	}
+	chatID := msg.Chat.ID
+	fromID, toID := msg.From.ID, target.From.ID
+	now := time.Now()
+
+	thanksMux.Lock()
+	given, err := getThanksGivenSince(ctx, chatID, fromID, now.Add(-max(24*time.Hour, thanksPairCooldown)))
+	if err != nil {
+		thanksMux.Unlock()
+		zap.S().Infof("[giveThanks] getThanksGivenSince failed for userID=%d chatID=%d: %v", fromID, chatID, err)
+		return "Не удалось записать благодарность, попробуйте позже", false
+	}
+	if denial := thanksDenial(given, toID, now); denial != "" {
+		thanksMux.Unlock()
+		return denial, false
+	}
+	saveThanks(ctx, &ThanksRecord{ChatID: chatID, FromID: fromID, ToID: toID, MessageID: target.ID, Date: now})
+	thanksMux.Unlock()
+
+	userAddKarma(ctx, toID, thanksKarma)
+	chatMemberAddKarma(ctx, chatID, toID, thanksKarma)
+	zap.S().Infof("[giveThanks] chatID=%d userID=%d thanked userID=%d for messageID=%d", chatID, fromID, toID, target.ID)
+	name := target.From.Username
+	if name == "" {
+		name = strings.TrimSpace(target.From.FirstName + " " + target.From.LastName)
+	}
+	return fmt.Sprintf("Спасибо принято: %s получает %+d к карме", name, thanksKarma), true
+}
+
+// thanksHandler serves /thanks sent as a reply to the message to thank for.
+func thanksHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	answer, _ := giveThanks(ctx, update.Message)
+	systemAnswerToMessage(ctx, b, update.Message.Chat.ID, update.Message.ID, escape(answer), true, 30)
+}
+
+// processThanksWord gives thanks for replies that are one of the chat's
+// trigger words. Refusals stay silent: the word may not have been meant for
+// the bot.
+func processThanksWord(ctx context.Context, b *bot.Bot, msg *models.Message) {
+	if msg.ReplyToMessage == nil || msg.Text == "" {
+		return
+	}
+	words := chatThanksWords(msg.Chat.ID)
+	if len(words) == 0 || !isThanksMessage(msg.Text, words) {
+		return
+	}
+	if answer, ok := giveThanks(ctx, msg); ok {
+		systemAnswerToMessage(ctx, b, msg.Chat.ID, msg.ID, escape(answer), false, 15)
+	}
+}
+
+// thanksWordsHandler shows or edits the replies that thank the author.
+// Usage: /thanks_words [add <слово> | remove <слово> | on | off | reset]
+func thanksWordsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	msgID := update.Message.ID
+	if !isUserAdmin(ctx, b, chatID, update.Message.From.ID, chatID, msgID) {
+		return
+	}
+	args := strings.Fields(update.Message.Text)[1:]
+	usage := "Использование: /thanks_words add <слово>, /thanks_words remove <слово>, /thanks_words on|off или /thanks_words reset"
+
+	if len(args) == 0 {
+		status := "выключены, работает только /thanks"
+		if words := chatThanksWords(chatID); len(words) != 0 {
+			status = strings.Join(words, ", ")
+		}
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(fmt.Sprintf("Слова благодарности: %s\n\n%s", status, usage)), true, 60)
+		return
+	}
+
+	command := strings.ToLower(args[0])
+	word := strings.ToLower(strings.Join(args[1:], " "))
+	switch {
+	case (command == "add" || command == "remove") && word != "" && utf8.RuneCountInString(word) <= thanksWordMaxLength:
+	case (command == "on" || command == "off" || command == "reset") && len(args) == 1:
+	default:
+		systemAnswerToMessage(ctx, b, chatID, msgID, escape(usage), true, 30)
+		return
+	}
+
+	settingsMux.Lock()
+	chatSettings := getChatSettings(ctx, chatID)
+	switch command {
+	case "add", "remove":
+		// Editing starts from the defaults, so one of them can be removed.
+		words := chatSettings.ThanksWords
+		if len(words) == 0 {
+			words = slices.Clone(defaultThanksWords)
+		}
+		if command == "add" && !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+		if command == "remove" {
+			words = slices.DeleteFunc(words, func(w string) bool { return w == word })
+		}
+		chatSettings.ThanksWords = words
+		chatSettings.ThanksWordsOff = false
+	case "on":
+		chatSettings.ThanksWordsOff = false
+	case "off":
+		chatSettings.ThanksWordsOff = true
+	case "reset":
+		chatSettings.ThanksWords = nil
+		chatSettings.ThanksWordsOff = false
+	}
+	writeChatSettings(ctx, chatID, chatSettings)
+	settingsMux.Unlock()
+
+	zap.S().Infof("[thanksWordsHandler] chatID=%d %v by userID=%d", chatID, args, update.Message.From.ID)
+	status := "выключены, работает только /thanks"
+	if words := chatThanksWords(chatID); len(words) != 0 {
+		status = strings.Join(words, ", ")
+	}
+	systemAnswerToMessage(ctx, b, chatID, msgID, escape("Слова благодарности: "+status), true, 30)
+}
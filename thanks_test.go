@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsThanksMessage(t *testing.T) {
+	words := []string{"+1", "спасибо", "спс"}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"+1", true},
+		{"  Спасибо!  ", true},
+		{"спасибо, помогло", true},
+		{"+1 к этому", true},
+		{"спс)", true},
+		{"+10", false},
+		{"спасибочки", false},
+		{"ну спасибо", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, isThanksMessage(tt.text, words))
+		})
+	}
+	assert.False(t, isThanksMessage("+1", nil))
+}
+
+func TestThanksDenial(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	thanks := func(toID int64, ago time.Duration) ThanksRecord {
+		return ThanksRecord{ChatID: 1, FromID: 2, ToID: toID, Date: now.Add(-ago)}
+	}
+
+	assert.Empty(t, thanksDenial(nil, 3, now))
+	assert.Contains(t, thanksDenial([]ThanksRecord{thanks(3, time.Hour)}, 3, now), "не чаще")
+	assert.Empty(t, thanksDenial([]ThanksRecord{thanks(3, thanksPairCooldown)}, 3, now))
+	assert.Empty(t, thanksDenial([]ThanksRecord{thanks(4, time.Hour)}, 3, now))
+
+	var given []ThanksRecord
+	for i := range thanksDailyLimit {
+		given = append(given, thanks(int64(10+i), time.Duration(i+1)*time.Hour))
+	}
+	assert.Contains(t, thanksDenial(given, 3, now), "в сутки")
+	// Thanks older than a day no longer count towards the limit.
+	given[0] = thanks(10, 25*time.Hour)
+	assert.Empty(t, thanksDenial(given, 3, now))
+}
@@ -53,13 +53,13 @@ func prepareBanInfo(ctx context.Context, chatID, userID int64) *BanInfo {
 	}
 	banInfo.ProfileName = user.AltUsername
 	banInfo.UserName = user.Username
-	banInfo.Score = calculateRequiredRating(user.Counter)
+	banInfo.Score = calculateRequiredRating(recentRating(ctx, chatID, userID))
 
 	messages, err := getUserLastNthMessages(ctx, userID, chatID, 1)
 	if err != nil || len(messages) == 0 {
 		banInfo.LastMessage = "Сообщение не найдено"
 	} else {
-		banInfo.LastMessage = messages[0].Text
+		banInfo.LastMessage = messages[0].displayText()
 		banInfo.TargetMessageID = messages[0].MessageID
 	}
 	return banInfo
@@ -58,7 +58,7 @@ func getInfoByMessage(ctx context.Context, chatID, messageID int64, banType uint
 	if user.AltUsername != "" {
 		banInfo.ProfileName = user.AltUsername
 	}
-	banInfo.Score = calculateRequiredRating(user.Counter)
+	banInfo.Score = calculateRequiredRating(recentRating(ctx, chatID, banInfo.UserID))
 	banInfo.BanMessage = makeMessage(banInfo)
 	return banInfo, nil
 }
@@ -102,7 +102,7 @@ func appendRecentMessages(report string, userMessages []ChatMessage) (string, []
 	text := make([]string, 0, len(userMessages))
 	for _, v := range userMessages {
 		ids = append(ids, v.MessageID)
-		text = append(text, quoteText(v.Text))
+		text = append(text, quoteText(v.displayText()))
 	}
 	escapedText := firstN(strings.Join(text, "\n"), 3500)
 	report = fmt.Sprintf("%s\nПоследние сообщения от пользователя:\n%s", report, escapedText)
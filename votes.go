@@ -283,17 +283,22 @@ func castVote(ctx context.Context, b *bot.Bot, s *BanInfo, chatSession map[int64
 		// arrive for the same vote message.
 		settleSession(s, chatSession, msgID)
 		return voteResult{answer: answer, counted: true, decided: true, action: func() {
-			if vt.apply(ctx, b, s) {
+			recordPatternOutcome(ctx, s, HIT_PASSED)
+			if vt.apply(ctx, b, s) && !vt.noFrag {
 				go updateUserFragTag(ctx, b, s.ChatID, s.OwnerID)
 			}
 		}}
 	case -1:
 		settleSession(s, chatSession, msgID)
 		return voteResult{answer: answer, counted: true, decided: true, action: func() {
+			recordPatternOutcome(ctx, s, HIT_CANCELLED)
 			b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: s.ChatID, MessageID: int(s.VoteMessageID)})
 			if s.RequestMessageID != 0 {
 				b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: s.ChatID, MessageID: int(s.RequestMessageID)})
 			}
+			if vt.cancel != nil {
+				vt.cancel(ctx, b, s)
+			}
 		}}
 	}
 
@@ -428,6 +433,7 @@ func collectExpiredVotesLocked(shouldExpire func(*BanInfo) bool, tag string) []e
 // Must be called without holding sessionsMux.
 func expireVotes(ctx context.Context, expired []expiredVote) {
 	for _, e := range expired {
+		recordPatternOutcome(ctx, e.s, HIT_EXPIRED)
 		myBot.UnpinChatMessage(ctx, &bot.UnpinChatMessageParams{
 			ChatID:    e.chatID,
 			MessageID: int(e.msgID),
@@ -447,6 +453,9 @@ func expireVotes(ctx context.Context, expired []expiredVote) {
 			Text:      voteExpiredText(e.s.UserName, e.s.ProfileName, e.s.UserID),
 			ParseMode: models.ParseModeMarkdown,
 		})
+		if vt, ok := voteTypes[e.s.Type]; ok && vt.expire != nil {
+			vt.expire(ctx, myBot, e.s)
+		}
 	}
 }
 
@@ -109,17 +109,26 @@ func TestVoteVerdict(t *testing.T) {
 func TestVoteTypesCoverEveryType(t *testing.T) {
 	// Every vote type must have a table entry: castVote and getVoteButtons both
 	// fall back to an error path for a type that is missing one.
-	for _, voteType := range []uint8{BAN, MUTE, TEXT_ONLY} {
+	for _, voteType := range []uint8{BAN, MUTE, TEXT_ONLY, JOIN_REQUEST} {
 		vt, ok := voteTypes[voteType]
 		require.True(t, ok, "vote type %d has no voteTypes entry", voteType)
 		assert.NotEmpty(t, vt.upText, "type %d upText", voteType)
 		assert.NotEmpty(t, vt.downText, "type %d downText", voteType)
 		assert.NotEmpty(t, vt.upAnswer, "type %d upAnswer", voteType)
 		assert.NotEmpty(t, vt.downAnswer, "type %d downAnswer", voteType)
+		assert.NotNil(t, vt.message, "type %d message", voteType)
 		assert.NotNil(t, vt.apply, "type %d apply", voteType)
 	}
 }
 
+func TestOnlyPunitiveVotesEarnFrags(t *testing.T) {
+	// The ban log seeding counts frags for these types only.
+	for _, voteType := range []uint8{BAN, MUTE, TEXT_ONLY} {
+		assert.False(t, voteTypes[voteType].noFrag, "type %d must earn a frag", voteType)
+	}
+	assert.True(t, voteTypes[JOIN_REQUEST].noFrag, "approving a join request is not a frag")
+}
+
 func TestCastVote(t *testing.T) {
 	const (
 		chatID = int64(-1001234567890)